@@ -2,73 +2,380 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/denarced/dafavorites/lib/dafavorites"
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
 	"github.com/denarced/dafavorites/shared/shared"
 	"github.com/spf13/afero"
 )
 
+const (
+	manifestFilename = "deviantFetch.json"
+	// The checksums of saved files in the format of sha256sum.
+	checksumsFilename = "SHA256SUMS"
+)
+
 func main() {
 	shared.InitLogging()
 	shared.Logger.Info("Start.", "args", os.Args)
-	args := os.Args[1:]
-	if len(args) < 1 {
-		fmt.Println("Missing username")
-		fmt.Printf("Usage: %s {username}\n", os.Args[0])
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "urls":
+			runURLs(os.Args[2:])
+			return
+		case "licenses":
+			runLicenses(os.Args[2:])
+			return
+		case "verify":
+			runVerify(os.Args[2:])
+			return
+		case "repair":
+			runRepair(os.Args[2:])
+			return
+		case "view":
+			runView(os.Args[2:])
+			return
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		}
+	}
+	runFetch()
+}
+
+// Fetch favorites, galleries, search results and feeds.
+func runFetch() {
+	favorites := flag.Bool("favorites", true, "Fetch the users' favorites.")
+	gallery := flag.Bool("gallery", false, "Fetch the users' own galleries.")
+	collections := flag.Bool(
+		"collections",
+		false,
+		"Fetch the users' favorites collection by collection.")
+	byCollection := flag.Bool(
+		"by-collection",
+		false,
+		"Place deviations in sub directories named after their collection. Needs -collections.")
+	usersFile := flag.String(
+		"users-file",
+		"",
+		"File with one username per line, fetched in addition to the ones in arguments.")
+	search := flag.String(
+		"search",
+		"",
+		"Fetch the results of a search query, e.g. \"tag:landscape sort:time\".")
+	maxResults := flag.Int(
+		"max-results",
+		0,
+		"Fetch at most this many results of the search query, 0 for no limit.")
+	maxPages := flag.Int("max-pages", 0, "Read at most this many pages per source, 0 for no limit.")
+	maxItems := flag.Int("max-items", 0, "Read at most this many items per source, 0 for no limit.")
+	since := flag.String(
+		"since",
+		"",
+		"Skip deviations published before this date, e.g. \"2024-05-01\". Only galleries and "+
+			"searches sorted by time stop early at the date, for favorites use \"last\" that "+
+			"stops at the first deviation already in the archive.")
+	var feeds, includes, excludes stringList
+	flag.Var(
+		&feeds,
+		"feed",
+		"Fetch any Media RSS or Atom feed, e.g. \"https://example.com/atom.xml\". Can be repeated.")
+	flag.Var(
+		&includes,
+		"include",
+		"Download only deviations that match, e.g. \"width>=1000\". Can be repeated.")
+	flag.Var(
+		&excludes,
+		"exclude",
+		"Skip deviations that match, e.g. \"rating=adult\". Can be repeated.")
+	contentAddressed := flag.Bool(
+		"content-addressed",
+		false,
+		"Store each distinct file once under \"blobs\" and link to it from the deviations' paths.")
+	dir := flag.String(
+		"dir",
+		"",
+		"Directory to download to, created if missing. Defaults to a new temporary directory.")
+	flag.Usage = func() {
+		fmt.Printf("Usage: %s [options] [username]...\n", os.Args[0])
+		fmt.Printf("       %s urls [options] [file]\n", os.Args[0])
+		fmt.Printf("       %s licenses [dir]\n", os.Args[0])
+		fmt.Printf("       %s verify [dir]\n", os.Args[0])
+		fmt.Printf("       %s repair [dir]\n", os.Args[0])
+		fmt.Printf("       %s view -by field [options] [dir]\n", os.Args[0])
+		fmt.Printf("       %s diff [options] old new\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	// Only collections have names to place deviations by.
+	if *byCollection && !(*favorites && *collections) {
+		fmt.Fprintln(os.Stderr, "Option -by-collection needs -collections.")
+		os.Exit(4)
+	}
+
+	usernames, err := readUsernames(flag.Args(), *usersFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read usernames.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(usernames) == 0 && *search == "" && len(feeds) == 0 {
+		fmt.Println("Missing username, search query or feed")
+		flag.Usage()
 		os.Exit(4)
 		return
 	}
 
-	username := strings.TrimSpace(os.Args[1])
-	if len(username) == 0 {
-		fmt.Println("Username can't be empty")
+	ctx := newProductionContext(&afero.Afero{Fs: afero.NewOsFs()}, usernames)
+	var sources []dafavorites.Source
+	for _, username := range usernames {
+		if *favorites && *collections {
+			folders, err := dafavorites.FetchCollections(username, ctx)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to list collections.")
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			for _, each := range folders {
+				sources = append(sources, dafavorites.NewCollectionSource(username, each))
+			}
+		} else if *favorites {
+			sources = append(sources, dafavorites.NewFavoritesSource(username))
+		}
+		if *gallery {
+			sources = append(sources, dafavorites.NewGallerySource(username))
+		}
+	}
+	if *search != "" {
+		source := dafavorites.NewSearchSource(*search)
+		if *maxResults > 0 {
+			source = dafavorites.NewLimitedSource(source, *maxResults)
+		}
+		sources = append(sources, source)
+	}
+	for _, each := range feeds {
+		sources = append(sources, dafavorites.NewFeedSource(each))
+	}
+	if len(sources) == 0 {
+		fmt.Println("Nothing to fetch, both favorites and gallery are disabled")
 		os.Exit(1)
 	}
 
-	shared.Logger.Debug("Create temporary directory.")
-	dirpath, err := os.MkdirTemp("", "")
+	dirpath, err := createDir(*dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to create the download directory.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	previous, err := loadPrevious(dirpath)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Failed to create a temporary directory.")
+		fmt.Fprintln(os.Stderr, "Failed to read the archive's previous fetch.")
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(2)
 	}
+	options := dafavorites.Options{
+		Dirpath:      dirpath,
+		WorkerCount:  4,
+		ByCollection: *byCollection,
+		MaxPages:     *maxPages,
+		MaxItems:     *maxItems,
+		Previous:     previous,
+		// Given once the archive uses blobs, they're used in later fetches too.
+		ContentAddressed: *contentAddressed || usesBlobs(previous),
+	}
+	if err := parseSince(*since, &options); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(includes) > 0 || len(excludes) > 0 {
+		options.Filter, err = dafavorites.ParseFilter(includes, excludes)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	deviantFetch := dafavorites.Fetch(sources, options, ctx)
+	saveFetch(deviantFetch, dirpath)
+}
 
-	ctx := newProductionContext(&afero.Afero{Fs: afero.NewOsFs()}, username)
-	deviantFetch := dafavorites.FetchFavorites(dirpath, 4, ctx)
+// Save the fetched deviations' information in directory dirpath and exit on failure.
+func saveFetch(deviantFetch djson.DeviantFetch, dirpath string) {
 	shared.Logger.Info("Deviations fetched.", "count", len(deviantFetch.SavedDeviations))
-	err = dafavorites.SaveJSON(deviantFetch, filepath.Join(dirpath, "deviantFetch.json"))
+	err := dafavorites.SaveJSON(deviantFetch, filepath.Join(dirpath, manifestFilename))
+	if err == nil {
+		err = dafavorites.SaveChecksums(deviantFetch, filepath.Join(dirpath, checksumsFilename))
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Failed.")
 		fmt.Fprintln(os.Stderr, err)
 		shared.Logger.Error("Done, failed.", "error", err)
 		os.Exit(3)
 	}
+	for _, each := range deviantFetch.Listings {
+		if !each.Complete {
+			fmt.Printf(
+				"Listing of %s was truncated: %s.\n",
+				describeOrigin(each.Origin),
+				each.Reason)
+		}
+	}
+	// The files of deviations that disappeared are kept, this only tells what they are.
+	if removed := dafavorites.NewlyRemoved(deviantFetch); len(removed) > 0 {
+		fmt.Printf("%d deviations disappeared since the previous fetch:\n", len(removed))
+		for _, each := range removed {
+			fmt.Printf(
+				"  %s by %s, %s: %s\n",
+				each.RssItem.Title,
+				each.RssItem.Author,
+				each.RemovedReason,
+				each.Filename)
+		}
+	}
 	fmt.Printf("Done. Deviations downloaded to %s.\n", dirpath)
 	shared.Logger.Info("Done.")
 }
 
+// StringList is a flag that can be given several times.
+type stringList []string
+
+func (v *stringList) String() string {
+	return strings.Join(*v, ", ")
+}
+
+func (v *stringList) Set(value string) error {
+	*v = append(*v, value)
+	return nil
+}
+
+// Describe origin for humans, e.g. "favorites of david".
+func describeOrigin(origin djson.Origin) string {
+	switch {
+	case origin.CollectionName != "":
+		return fmt.Sprintf("collection %q of %s", origin.CollectionName, origin.Username)
+	case origin.Username != "":
+		return fmt.Sprintf("%s of %s", origin.Kind, origin.Username)
+	case origin.Query != "":
+		return fmt.Sprintf("%s %q", origin.Kind, origin.Query)
+	case origin.FeedURL != "":
+		return fmt.Sprintf("%s %s", origin.Kind, origin.FeedURL)
+	}
+	return origin.Kind
+}
+
+// Load the previous fetch from archive directory dirpath. Return nil if there's none.
+func loadPrevious(dirpath string) (*djson.DeviantFetch, error) {
+	filep := filepath.Join(dirpath, manifestFilename)
+	if _, err := os.Stat(filep); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	previous, err := dafavorites.LoadJSON(filep)
+	if err != nil {
+		return nil, err
+	}
+	shared.Logger.Info("Previous fetch loaded.", "count", len(previous.SavedDeviations))
+	return &previous, nil
+}
+
+// Return true if any deviation in the previous fetch is stored as a blob.
+func usesBlobs(previous *djson.DeviantFetch) bool {
+	if previous == nil {
+		return false
+	}
+	for _, each := range previous.SavedDeviations {
+		if each.Blob != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse option "since" into options. It's either empty, "last" or a date.
+func parseSince(value string, options *dafavorites.Options) error {
+	if value == "" {
+		return nil
+	}
+	if value == "last" {
+		if options.Previous == nil {
+			return errors.New("there's no previous fetch in the directory, use option -dir")
+		}
+		options.StopAtKnown = true
+		return nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			options.Since = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid value for since: %q", value)
+}
+
+// Create directory dirpath unless it exists already. Empty dirpath creates a new temporary
+// directory. Return the directory's path.
+func createDir(dirpath string) (string, error) {
+	if dirpath == "" {
+		shared.Logger.Debug("Create temporary directory.")
+		return os.MkdirTemp("", "")
+	}
+	shared.Logger.Debug("Create directory.", "dirpath", dirpath)
+	return dirpath, os.MkdirAll(dirpath, 0700)
+}
+
+// Read usernames from args and, if usersFile isn't empty, from file usersFile. Empty lines
+// and lines starting with "#" in the file are ignored. Duplicates are removed.
+func readUsernames(args []string, usersFile string) ([]string, error) {
+	candidates := args
+	if usersFile != "" {
+		content, err := os.ReadFile(usersFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, each := range strings.Split(string(content), "\n") {
+			if strings.HasPrefix(strings.TrimSpace(each), "#") {
+				continue
+			}
+			candidates = append(candidates, each)
+		}
+	}
+
+	var usernames []string
+	for _, each := range candidates {
+		username := strings.TrimSpace(each)
+		if username == "" || slices.Contains(usernames, username) {
+			continue
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, nil
+}
+
 type productionContext struct {
-	fsys     *afero.Afero
-	username string
+	fsys      *afero.Afero
+	usernames []string
 }
 
-func newProductionContext(fsys *afero.Afero, username string) *productionContext {
+func newProductionContext(fsys *afero.Afero, usernames []string) *productionContext {
 	return &productionContext{
-		fsys:     fsys,
-		username: username,
+		fsys:      fsys,
+		usernames: usernames,
 	}
 }
 
-// Username .
-func (v *productionContext) Username() string {
-	return v.username
+// Usernames .
+func (v *productionContext) Usernames() []string {
+	return v.usernames
 }
 
 func (v *productionContext) Fsys() *afero.Afero {
@@ -101,3 +408,22 @@ func (v *RealHTTPClient) Fetch(url string) ([]byte, error) {
 	defer res.Body.Close()
 	return io.ReadAll(res.Body)
 }
+
+// Download .
+func (v *RealHTTPClient) Download(url string) (dafavorites.Response, error) {
+	res, err := v.client.Get(url)
+	if err != nil {
+		return dafavorites.Response{}, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return dafavorites.Response{}, err
+	}
+	return dafavorites.Response{
+		Body:          body,
+		StatusCode:    res.StatusCode,
+		ContentType:   res.Header.Get("Content-Type"),
+		ContentLength: res.ContentLength,
+	}, nil
+}
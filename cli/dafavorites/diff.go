@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/denarced/dafavorites/lib/dafavorites"
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+)
+
+// Compare two manifests and print the deviations that were added, removed and changed.
+func runDiff(args []string) {
+	flagSet := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := flagSet.String(
+		"format",
+		dafavorites.DiffFormatText,
+		"Output format: text, json or markdown.")
+	flagSet.Usage = func() {
+		fmt.Printf("Usage: %s diff [options] old new\n", os.Args[0])
+		fmt.Println("Compares two manifests, each given as the manifest file or as the archive " +
+			"directory that contains it.")
+		flagSet.PrintDefaults()
+	}
+	_ = flagSet.Parse(args)
+	if flagSet.NArg() != 2 {
+		flagSet.Usage()
+		os.Exit(4)
+	}
+
+	older, err := loadManifest(flagSet.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read the old manifest.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	newer, err := loadManifest(flagSet.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read the new manifest.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	diff, err := dafavorites.DiffManifests(older, newer)
+	if err == nil {
+		err = dafavorites.WriteDiff(os.Stdout, diff, *format)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to compare the manifests.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+// Load the manifest in path, either the manifest file itself or the archive directory.
+func loadManifest(path string) (djson.DeviantFetch, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, manifestFilename)
+	}
+	return dafavorites.LoadJSON(path)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/denarced/dafavorites/lib/dafavorites"
+)
+
+// List the deviations of an archive by license.
+func runLicenses(args []string) {
+	flagSet := flag.NewFlagSet("licenses", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Printf("Usage: %s licenses [dir]\n", os.Args[0])
+		fmt.Println("Lists the deviations archived in dir, or in the current directory, by license.")
+		flagSet.PrintDefaults()
+	}
+	_ = flagSet.Parse(args)
+
+	dirpath := flagSet.Arg(0)
+	if dirpath == "" {
+		dirpath = "."
+	}
+	deviantFetch, err := dafavorites.LoadJSON(filepath.Join(dirpath, manifestFilename))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read the archive.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	for _, group := range dafavorites.GroupByLicense(deviantFetch.SavedDeviations) {
+		name := group.License.Name
+		switch {
+		case group.License.URL == "":
+			name = "No license"
+		case name == "":
+			name = group.License.URL
+		}
+		fmt.Printf("%s (%d)\n", name, len(group.Deviations))
+		for _, each := range group.Deviations {
+			fmt.Printf("  %s by %s: %s\n", each.RssItem.Title, each.RssItem.Author, each.RssItem.Link)
+		}
+	}
+}
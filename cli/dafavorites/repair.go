@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/denarced/dafavorites/lib/dafavorites"
+	"github.com/spf13/afero"
+)
+
+// Re-download the missing and corrupt files of an archive and update its manifest.
+func runRepair(args []string) {
+	flagSet := flag.NewFlagSet("repair", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Printf("Usage: %s repair [dir]\n", os.Args[0])
+		fmt.Println("Re-downloads the missing and corrupt files archived in dir, or in the " +
+			"current directory, and updates the archive's manifest.")
+		flagSet.PrintDefaults()
+	}
+	_ = flagSet.Parse(args)
+
+	dirpath := flagSet.Arg(0)
+	if dirpath == "" {
+		dirpath = "."
+	}
+	deviantFetch, err := dafavorites.LoadJSON(filepath.Join(dirpath, manifestFilename))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read the archive.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	ctx := newProductionContext(&afero.Afero{Fs: afero.NewOsFs()}, nil)
+	repaired, report, err := dafavorites.Repair(dirpath, deviantFetch, ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to repair the archive.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	err = dafavorites.SaveJSON(repaired, filepath.Join(dirpath, manifestFilename))
+	if err == nil {
+		err = dafavorites.SaveChecksums(repaired, filepath.Join(dirpath, checksumsFilename))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to save the archive's manifest.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(3)
+	}
+	for _, each := range report.Repaired {
+		fmt.Println("repaired:", each)
+	}
+	for _, each := range report.Failed {
+		fmt.Println("failed:", each)
+	}
+	fmt.Printf("%d repaired, %d failed.\n", len(report.Repaired), len(report.Failed))
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
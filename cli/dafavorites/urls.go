@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/denarced/dafavorites/lib/dafavorites"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+)
+
+// Fetch the deviations listed in a file or stdin, one URL per line.
+func runURLs(args []string) {
+	flagSet := flag.NewFlagSet("urls", flag.ExitOnError)
+	dir := flagSet.String(
+		"dir",
+		"",
+		"Directory to download to, created if missing. Defaults to a new temporary directory.")
+	flagSet.Usage = func() {
+		fmt.Printf("Usage: %s urls [options] [file]\n", os.Args[0])
+		fmt.Println("Reads deviation URLs from file, or from stdin if file is missing or \"-\".")
+		flagSet.PrintDefaults()
+	}
+	_ = flagSet.Parse(args)
+
+	urls, err := readURLs(flagSet.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read URLs.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(urls) == 0 {
+		fmt.Println("No URLs to fetch")
+		os.Exit(4)
+	}
+
+	dirpath, err := createDir(*dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to create the download directory.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	previous, err := loadPrevious(dirpath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read the archive's previous fetch.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	ctx := newProductionContext(&afero.Afero{Fs: afero.NewOsFs()}, nil)
+	options := dafavorites.Options{Dirpath: dirpath, WorkerCount: 4, Previous: previous}
+	deviantFetch := dafavorites.Fetch(
+		[]dafavorites.Source{dafavorites.NewURLListSource(urls)},
+		options,
+		ctx)
+	saveFetch(deviantFetch, dirpath)
+}
+
+// Read URLs from file filep, or from stdin if filep is empty or "-". Empty lines and lines
+// starting with "#" are ignored.
+func readURLs(filep string) ([]string, error) {
+	var reader io.Reader = os.Stdin
+	if filep != "" && filep != "-" {
+		file, err := os.Open(filep)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	var urls []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		shared.Logger.Error("Failed to read URLs.", "error", err)
+		return nil, err
+	}
+	return urls, nil
+}
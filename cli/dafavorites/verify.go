@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/denarced/dafavorites/lib/dafavorites"
+	"github.com/spf13/afero"
+)
+
+// Check the files of an archive against its manifest.
+func runVerify(args []string) {
+	flagSet := flag.NewFlagSet("verify", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Printf("Usage: %s verify [dir]\n", os.Args[0])
+		fmt.Println("Checks the files archived in dir, or in the current directory, against " +
+			"their checksums and reports missing, changed and extra files.")
+		flagSet.PrintDefaults()
+	}
+	_ = flagSet.Parse(args)
+
+	dirpath := flagSet.Arg(0)
+	if dirpath == "" {
+		dirpath = "."
+	}
+	deviantFetch, err := dafavorites.LoadJSON(filepath.Join(dirpath, manifestFilename))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read the archive.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	ctx := newProductionContext(&afero.Afero{Fs: afero.NewOsFs()}, nil)
+	report, err := dafavorites.Verify(
+		dirpath,
+		deviantFetch,
+		[]string{manifestFilename, checksumsFilename, "dafavorites.log"},
+		ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to verify the archive.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	for _, each := range report.Missing {
+		fmt.Println("missing:", each)
+	}
+	for _, each := range report.Changed {
+		fmt.Println("changed:", each)
+	}
+	for _, each := range report.Extra {
+		fmt.Println("extra:", each)
+	}
+	for _, each := range report.Unchecked {
+		fmt.Println("no checksum:", each)
+	}
+	fmt.Printf(
+		"%d verified, %d missing, %d changed, %d extra, %d without checksum.\n",
+		report.Verified,
+		len(report.Missing),
+		len(report.Changed),
+		len(report.Extra),
+		len(report.Unchecked))
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
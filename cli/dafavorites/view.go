@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/denarced/dafavorites/lib/dafavorites"
+	"github.com/spf13/afero"
+)
+
+// Build directory trees of links that group an archive's deviations by manifest fields.
+func runView(args []string) {
+	flagSet := flag.NewFlagSet("view", flag.ExitOnError)
+	var fields stringList
+	flagSet.Var(
+		&fields,
+		"by",
+		"Group by this field: "+strings.Join(dafavorites.ViewFields, ", ")+
+			" or the path of any field in the manifest, e.g. Origins.Kind. Can be repeated.")
+	hardlinks := flagSet.Bool("hardlinks", false, "Create hard links instead of symbolic links.")
+	flagSet.Usage = func() {
+		fmt.Printf("Usage: %s view -by field [options] [dir]\n", os.Args[0])
+		fmt.Println("Builds or updates views/<field> in the archive in dir, or in the current " +
+			"directory, with links to the deviations grouped by field.")
+		flagSet.PrintDefaults()
+	}
+	_ = flagSet.Parse(args)
+	if len(fields) == 0 {
+		flagSet.Usage()
+		os.Exit(4)
+	}
+
+	dirpath := flagSet.Arg(0)
+	if dirpath == "" {
+		dirpath = "."
+	}
+	deviantFetch, err := dafavorites.LoadJSON(filepath.Join(dirpath, manifestFilename))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read the archive.")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	ctx := newProductionContext(&afero.Afero{Fs: afero.NewOsFs()}, nil)
+	for _, each := range fields {
+		report, err := dafavorites.BuildView(dirpath, deviantFetch, each, *hardlinks, ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to build view by %s.\n", each)
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		fmt.Printf(
+			"View by %s: %d created, %d kept, %d removed.\n",
+			each,
+			report.Created,
+			report.Kept,
+			report.Removed)
+	}
+}
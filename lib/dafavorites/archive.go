@@ -0,0 +1,262 @@
+package dafavorites
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+)
+
+// ArchiveIndex tells which deviations are already in the archive, i.e. in the previous fetch.
+type archiveIndex struct {
+	// Keyed by deviationKey.
+	deviations map[string]djson.RssItem
+	fromOrigin map[originDeviation]bool
+}
+
+// OriginDeviation is a deviation found from a specific origin.
+type originDeviation struct {
+	origin djson.Origin
+	key    string
+}
+
+func newArchiveIndex(previous *djson.DeviantFetch) archiveIndex {
+	index := archiveIndex{
+		deviations: map[string]djson.RssItem{},
+		fromOrigin: map[originDeviation]bool{},
+	}
+	if previous == nil {
+		return index
+	}
+	for _, each := range previous.SavedDeviations {
+		key := deviationKey(each.RssItem)
+		index.deviations[key] = each.RssItem
+		for _, origin := range each.Origins {
+			index.fromOrigin[originDeviation{origin: origin, key: key}] = true
+		}
+	}
+	return index
+}
+
+// Contains tells whether the archive contains the deviation with key.
+func (v archiveIndex) contains(key string) bool {
+	_, found := v.deviations[key]
+	return found
+}
+
+// IsReplaced tells whether the archive contains the deviation with key but item, the deviation as
+// it's listed now, has a different image.
+func (v archiveIndex) isReplaced(key string, item djson.RssItem) bool {
+	archived, found := v.deviations[key]
+	return found && isImageReplaced(archived, item)
+}
+
+// ContainsFrom tells whether the archive contains the deviation with key found from origin.
+func (v archiveIndex) containsFrom(origin djson.Origin, key string) bool {
+	return v.fromOrigin[originDeviation{origin: origin, key: key}]
+}
+
+// Merge the deviations fetched now into the previous fetch. The deviations of the previous fetch
+// are kept, with the origins they were found from now added and their metadata and positions
+// updated from result. Deviations that were downloaded now are appended, except the ones whose
+// image was replaced: they replace the archived deviation, which is kept as a previous version.
+// Previously skipped deviations are kept unless they were skipped or downloaded now. If previous
+// is nil, current is returned as such.
+func mergeFetch(
+	previous *djson.DeviantFetch,
+	current djson.DeviantFetch,
+	result fetchResult,
+) djson.DeviantFetch {
+	if previous == nil {
+		return current
+	}
+	shifts := derivePositionShifts(current.Listings, result.positions, newArchiveIndex(previous))
+	downloaded := map[string]djson.SavedDeviation{}
+	for _, each := range current.SavedDeviations {
+		downloaded[deviationKey(each.RssItem)] = each
+	}
+	merged := make(
+		[]djson.SavedDeviation,
+		0,
+		len(previous.SavedDeviations)+len(current.SavedDeviations))
+	for _, each := range previous.SavedDeviations {
+		key := deviationKey(each.RssItem)
+		// Copy so that the previous fetch isn't modified.
+		each.Origins = append([]djson.Origin(nil), each.Origins...)
+		for _, origin := range result.origins[key] {
+			each.Origins = appendOrigin(each.Origins, origin)
+		}
+		each.FavoritedBy = deriveFavoritedBy(each.Origins)
+		each.Positions = mergePositions(each.Positions, result.positions[key], shifts)
+		// Deviations archived before the times were recorded.
+		if each.FirstSeen.IsZero() {
+			each.FirstSeen = previous.Timestamp
+		}
+		if each.LastSeen.IsZero() {
+			each.LastSeen = previous.Timestamp
+		}
+		if item, found := result.seen[key]; found {
+			each = updateSeen(each, item, current.Timestamp)
+		}
+		if replacement, found := downloaded[key]; found {
+			each = replaceVersion(each, replacement, current.Timestamp)
+			delete(downloaded, key)
+		}
+		merged = append(merged, each)
+	}
+	for _, each := range current.SavedDeviations {
+		if _, found := downloaded[deviationKey(each.RssItem)]; found {
+			merged = append(merged, each)
+		}
+	}
+	current.SavedDeviations = merged
+
+	handled := map[string]bool{}
+	for _, each := range current.SavedDeviations {
+		handled[deviationKey(each.RssItem)] = true
+	}
+	for _, each := range current.Skipped {
+		handled[deviationKey(each.RssItem)] = true
+	}
+	for _, each := range previous.Skipped {
+		if !handled[deviationKey(each.RssItem)] {
+			current.Skipped = append(current.Skipped, each)
+		}
+	}
+	return current
+}
+
+// How the archived positions in an origin that was read now change.
+type positionShift struct {
+	// True when the origin was listed completely, so archived positions not found now are gone.
+	drop bool
+	// The number of deviations listed now that the origin didn't have before. They precede the
+	// archived deviations that weren't reached now.
+	items int
+	// The number of deviations on a page, zero when not known.
+	pageSize int
+}
+
+// Derive the shifts of archived positions for each origin in listings from positions, the current
+// positions keyed by deviationKey.
+func derivePositionShifts(
+	listings []djson.Listing,
+	positions map[string][]djson.Position,
+	index archiveIndex,
+) map[djson.Origin]positionShift {
+	pages := map[djson.Origin]int{}
+	shifts := map[djson.Origin]positionShift{}
+	for _, each := range listings {
+		pages[each.Origin] = each.Pages
+		shifts[each.Origin] = positionShift{drop: isExhaustive(each)}
+	}
+	firstPages := map[djson.Origin]int{}
+	for key, each := range positions {
+		for _, position := range each {
+			if position.Page == 1 {
+				firstPages[position.Origin]++
+			}
+			if !index.containsFrom(position.Origin, key) {
+				shift := shifts[position.Origin]
+				shift.items++
+				shifts[position.Origin] = shift
+			}
+		}
+	}
+	for origin, shift := range shifts {
+		// Only a page that was followed by another is known to be full.
+		if pages[origin] > 1 {
+			shift.pageSize = firstPages[origin]
+			shifts[origin] = shift
+		}
+	}
+	return shifts
+}
+
+// Merge the current positions of a deviation, the ones it was found at now, into its archived
+// positions. The archived positions in the origins found now are replaced and the ones in origins
+// that were listed completely, without the deviation, are dropped. The ones in origins that were
+// read only partly, e.g. up to a known deviation or to -max-pages, are moved past the deviations
+// that are new in the origin.
+func mergePositions(
+	archived, current []djson.Position,
+	shifts map[djson.Origin]positionShift,
+) []djson.Position {
+	var merged []djson.Position
+	for _, each := range archived {
+		replaced := slices.ContainsFunc(current, func(position djson.Position) bool {
+			return position.Origin == each.Origin
+		})
+		if replaced {
+			continue
+		}
+		shift, read := shifts[each.Origin]
+		if read && shift.drop {
+			continue
+		}
+		if read && shift.items > 0 {
+			each.Position += shift.items
+			if shift.pageSize > 0 {
+				each.Page = (each.Position-1)/shift.pageSize + 1
+			}
+		}
+		merged = append(merged, each)
+	}
+	return append(merged, current...)
+}
+
+// Sort deviations in the order they were listed now, positions keyed by deviationKey. The
+// sources are in the order of listings and a deviation is placed by the first source that lists
+// it, e.g. by favorites from the most recent. Deviations that weren't listed now, e.g. because
+// listing stopped early, come last in their current order.
+func sortByPosition(
+	deviations []djson.SavedDeviation,
+	listings []djson.Listing,
+	positions map[string][]djson.Position,
+) {
+	ranks := map[djson.Origin]int{}
+	for i, each := range listings {
+		ranks[each.Origin] = i
+	}
+	type sortKey struct {
+		rank     int
+		position int
+	}
+	deriveSortKey := func(key string) sortKey {
+		best := sortKey{rank: len(listings)}
+		for _, each := range positions[key] {
+			rank, found := ranks[each.Origin]
+			if !found {
+				continue
+			}
+			if rank < best.rank || (rank == best.rank && each.Position < best.position) {
+				best = sortKey{rank: rank, position: each.Position}
+			}
+		}
+		return best
+	}
+	keys := make(map[string]sortKey, len(deviations))
+	for _, each := range deviations {
+		key := deviationKey(each.RssItem)
+		keys[key] = deriveSortKey(key)
+	}
+	sort.SliceStable(deviations, func(i, j int) bool {
+		first := keys[deviationKey(deviations[i].RssItem)]
+		second := keys[deviationKey(deviations[j].RssItem)]
+		if first.rank != second.rank {
+			return first.rank < second.rank
+		}
+		return first.position < second.position
+	})
+}
+
+// Parse RSS item's publication date, e.g. "Mon, 15 Apr 2024 08:29:36 PDT".
+func parsePublicationDate(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC1123, time.RFC1123Z} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
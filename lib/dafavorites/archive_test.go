@@ -0,0 +1,338 @@
+package dafavorites
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchStopsEarly(t *testing.T) {
+	favorites := djson.Origin{Kind: SourceFavorites, Username: "denarced"}
+	katGUID := "https://www.deviantart.com/friesellfly/art/Kat-1042398875"
+	previous := &djson.DeviantFetch{
+		SavedDeviations: []djson.SavedDeviation{
+			{
+				RssItem:  djson.RssItem{Title: "Kat", GUID: katGUID},
+				Filename: "uuid/kat.jpg",
+				Origins:  []djson.Origin{favorites},
+			},
+			{
+				RssItem:  djson.RssItem{Title: "Old", GUID: "old"},
+				Filename: "old/old.jpg",
+				Origins:  []djson.Origin{{Kind: SourceGallery, Username: "someone"}},
+			},
+		},
+	}
+	run := func(name string, options Options, expectedTitles []string, expected djson.Listing) {
+		t.Run(name, func(t *testing.T) {
+			shared.InitTestLogging(t)
+			httpClient := newTestHTTPClient()
+			ctx := &TestContext{
+				fsys:       &afero.Afero{Fs: afero.NewMemMapFs()},
+				httpClient: httpClient,
+			}
+			options.Dirpath = "/root"
+			options.WorkerCount = 1
+
+			// EXERCISE
+			fetched := Fetch([]Source{NewFavoritesSource("denarced")}, options, ctx)
+
+			// VERIFY
+			ass := assert.New(t)
+			ass.Nil(httpClient.err)
+			var titles []string
+			for _, each := range fetched.SavedDeviations {
+				titles = append(titles, each.RssItem.Title)
+			}
+			ass.Equal(expectedTitles, titles)
+			expected.Origin = favorites
+			ass.Equal([]djson.Listing{expected}, fetched.Listings)
+		})
+	}
+
+	run(
+		"Stop at known",
+		Options{Previous: previous, StopAtKnown: true},
+		[]string{"Anna Rose 13", "Kat", "Old"},
+		djson.Listing{Reason: TruncatedKnown, Pages: 2, Items: 1})
+	run(
+		"Known not downloaded again",
+		Options{Previous: previous},
+		[]string{"Anna Rose 13", "Kat", "Old"},
+		djson.Listing{Complete: true, Pages: 2, Items: 2})
+	run(
+		"Since",
+		Options{Since: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		[]string{"Anna Rose 13"},
+		djson.Listing{Complete: true, Pages: 2, Items: 2})
+}
+
+func TestFetchSinceSkipsOldFavorites(t *testing.T) {
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	oldItem := djson.RssItem{
+		GUID:            "old",
+		Title:           "Old",
+		PublicationDate: "Mon, 15 Apr 2019 08:29:36 UTC",
+		URL:             katImageURL,
+	}
+	newItem := djson.RssItem{
+		GUID:            "new",
+		Title:           "New",
+		PublicationDate: "Wed, 15 May 2024 08:29:36 UTC",
+		URL:             annaImageURL,
+	}
+	run := func(name string, origin djson.Origin, expectedTitles []string, expected djson.Listing) {
+		t.Run(name, func(t *testing.T) {
+			shared.InitTestLogging(t)
+			ctx := &TestContext{
+				fsys:       &afero.Afero{Fs: afero.NewMemMapFs()},
+				httpClient: newTestHTTPClient(),
+			}
+			// Favorited today even though it was published long ago.
+			source := &testSource{pages: [][]djson.RssItem{{oldItem, newItem}}, origin: origin}
+
+			// EXERCISE
+			fetched := Fetch(
+				[]Source{source},
+				Options{Dirpath: "/root", WorkerCount: 1, Since: since},
+				ctx)
+
+			// VERIFY
+			ass := assert.New(t)
+			var titles []string
+			for _, each := range fetched.SavedDeviations {
+				titles = append(titles, each.RssItem.Title)
+			}
+			ass.Equal(expectedTitles, titles)
+			expected.Origin = origin
+			ass.Equal([]djson.Listing{expected}, fetched.Listings)
+		})
+	}
+
+	run(
+		"Favorites skip",
+		djson.Origin{Kind: SourceFavorites, Username: "david"},
+		[]string{"New"},
+		djson.Listing{Complete: true, Pages: 1, Items: 2})
+	run(
+		"Gallery stops",
+		djson.Origin{Kind: SourceGallery, Username: "david"},
+		nil,
+		djson.Listing{Reason: TruncatedSince, Pages: 1})
+}
+
+func TestMergeFetch(t *testing.T) {
+	shared.InitTestLogging(t)
+	gallery := djson.Origin{Kind: SourceGallery, Username: "friesellfly"}
+	favorites := djson.Origin{Kind: SourceFavorites, Username: "denarced"}
+	previous := &djson.DeviantFetch{
+		SavedDeviations: []djson.SavedDeviation{
+			{RssItem: djson.RssItem{GUID: "kat"}, Origins: []djson.Origin{gallery}},
+		},
+	}
+	current := djson.DeviantFetch{
+		SavedDeviations: []djson.SavedDeviation{
+			{RssItem: djson.RssItem{GUID: "anna"}, Origins: []djson.Origin{favorites}},
+		},
+	}
+
+	// EXERCISE
+	merged := mergeFetch(
+		previous,
+		current,
+		fetchResult{
+			origins: map[string][]djson.Origin{
+				"kat":  {favorites},
+				"anna": {favorites},
+			},
+		})
+
+	// VERIFY
+	ass := assert.New(t)
+	ass.Equal(2, len(merged.SavedDeviations))
+	ass.Equal([]djson.Origin{gallery, favorites}, merged.SavedDeviations[0].Origins)
+	ass.Equal([]string{"denarced"}, merged.SavedDeviations[0].FavoritedBy)
+	ass.Equal([]djson.Origin{gallery}, previous.SavedDeviations[0].Origins)
+	ass.Equal("anna", merged.SavedDeviations[1].RssItem.GUID)
+}
+
+func TestFetchSortsByPosition(t *testing.T) {
+	shared.InitTestLogging(t)
+	favorites := djson.Origin{Kind: SourceFavorites, Username: "david"}
+	gallery := djson.Origin{Kind: SourceGallery, Username: "david"}
+	previous := &djson.DeviantFetch{
+		SavedDeviations: []djson.SavedDeviation{
+			{
+				RssItem:   createRssItem("unlisted", katImageURL),
+				Filename:  "unlisted/kat.jpg",
+				Origins:   []djson.Origin{favorites},
+				Positions: []djson.Position{{Origin: favorites, Page: 1, Position: 1}},
+			},
+			{
+				RssItem:  createRssItem("c", katImageURL),
+				Filename: "c/kat.jpg",
+				Origins:  []djson.Origin{favorites, gallery},
+				Positions: []djson.Position{
+					{Origin: favorites, Page: 1, Position: 2},
+					{Origin: gallery, Page: 1, Position: 5},
+				},
+			},
+		},
+	}
+	sources := []Source{
+		&testSource{
+			pages: [][]djson.RssItem{
+				{createRssItem("a", katImageURL), createRssItem("b", katImageURL)},
+				{createRssItem("c", katImageURL)},
+			},
+			origin: favorites,
+		},
+		&testSource{
+			pages: [][]djson.RssItem{
+				{createRssItem("d", katImageURL), createRssItem("c", katImageURL)},
+			},
+			origin: gallery,
+		},
+	}
+	ctx := &TestContext{
+		fsys:       &afero.Afero{Fs: afero.NewMemMapFs()},
+		httpClient: newTestHTTPClient(),
+	}
+
+	// EXERCISE
+	fetched := Fetch(sources, Options{Dirpath: "/root", WorkerCount: 3, Previous: previous}, ctx)
+
+	// VERIFY
+	ass := assert.New(t)
+	var titles []string
+	positions := map[string][]djson.Position{}
+	for _, each := range fetched.SavedDeviations {
+		titles = append(titles, each.RssItem.Title)
+		positions[each.RssItem.Title] = each.Positions
+	}
+	ass.Equal([]string{"a", "b", "c", "d", "unlisted"}, titles)
+	ass.Equal([]djson.Position{{Origin: favorites, Page: 1, Position: 2}}, positions["b"])
+	ass.ElementsMatch(
+		[]djson.Position{
+			{Origin: favorites, Page: 2, Position: 3},
+			{Origin: gallery, Page: 1, Position: 2},
+		},
+		positions["c"])
+	ass.Empty(positions["unlisted"], "Favorites were listed completely without it.")
+}
+
+func TestFetchShiftsPositionsOfPartialListing(t *testing.T) {
+	favorites := djson.Origin{Kind: SourceFavorites, Username: "david"}
+	run := func(
+		name string,
+		options Options,
+		archived map[string]djson.Position,
+		pages [][]string,
+		expected map[string]djson.Position,
+	) {
+		t.Run(name, func(t *testing.T) {
+			shared.InitTestLogging(t)
+			previous := &djson.DeviantFetch{}
+			for _, guid := range []string{"a", "b", "c"} {
+				position := archived[guid]
+				position.Origin = favorites
+				previous.SavedDeviations = append(
+					previous.SavedDeviations,
+					djson.SavedDeviation{
+						RssItem:   createRssItem(guid, katImageURL),
+						Filename:  guid + "/kat.jpg",
+						Origins:   []djson.Origin{favorites},
+						Positions: []djson.Position{position},
+					})
+			}
+			ctx := &TestContext{
+				fsys:       &afero.Afero{Fs: afero.NewMemMapFs()},
+				httpClient: newTestHTTPClient(),
+			}
+			options.Dirpath = "/root"
+			options.WorkerCount = 1
+			options.Previous = previous
+			source := &testSource{origin: favorites}
+			for _, page := range pages {
+				var items []djson.RssItem
+				for _, guid := range page {
+					items = append(items, createRssItem(guid, katImageURL))
+				}
+				source.pages = append(source.pages, items)
+			}
+
+			// EXERCISE
+			fetched := Fetch([]Source{source}, options, ctx)
+
+			// VERIFY
+			ass := assert.New(t)
+			var titles []string
+			actual := map[string]djson.Position{}
+			for _, each := range fetched.SavedDeviations {
+				ass.Equal(1, len(each.Positions), each.RssItem.Title)
+				titles = append(titles, each.RssItem.Title)
+				actual[each.RssItem.Title] = each.Positions[0]
+			}
+			var expectedTitles []string
+			for guid, each := range expected {
+				each.Origin = favorites
+				expected[guid] = each
+				expectedTitles = append(expectedTitles, guid)
+			}
+			slices.SortFunc(expectedTitles, func(a, b string) int {
+				return expected[a].Position - expected[b].Position
+			})
+			ass.Equal(expected, actual)
+			ass.Equal(expectedTitles, titles)
+		})
+	}
+
+	onePage := map[string]djson.Position{
+		"a": {Page: 1, Position: 1},
+		"b": {Page: 1, Position: 2},
+		"c": {Page: 1, Position: 3},
+	}
+	run(
+		"Stop at known",
+		Options{StopAtKnown: true},
+		onePage,
+		[][]string{{"new", "a", "b", "c"}},
+		map[string]djson.Position{
+			"new": {Page: 1, Position: 1},
+			"a":   {Page: 1, Position: 2},
+			"b":   {Page: 1, Position: 3},
+			"c":   {Page: 1, Position: 4},
+		})
+	run(
+		"Max items past a known deviation",
+		Options{MaxItems: 2},
+		onePage,
+		[][]string{{"new", "a", "b", "c"}},
+		map[string]djson.Position{
+			"new": {Page: 1, Position: 1},
+			"a":   {Page: 1, Position: 2},
+			"b":   {Page: 1, Position: 3},
+			"c":   {Page: 1, Position: 4},
+		})
+	run(
+		"Max pages",
+		Options{MaxPages: 2},
+		map[string]djson.Position{
+			"a": {Page: 1, Position: 1},
+			"b": {Page: 1, Position: 2},
+			"c": {Page: 2, Position: 3},
+		},
+		[][]string{{"new", "newer"}, {"a", "b"}, {"c"}},
+		map[string]djson.Position{
+			"new":   {Page: 1, Position: 1},
+			"newer": {Page: 1, Position: 2},
+			"a":     {Page: 2, Position: 3},
+			"b":     {Page: 2, Position: 4},
+			"c":     {Page: 3, Position: 5},
+		})
+}
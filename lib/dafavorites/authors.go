@@ -0,0 +1,75 @@
+package dafavorites
+
+import (
+	"path/filepath"
+	"strings"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+)
+
+// The directory under the archive's root for the authors' avatars.
+const authorsDirname = "authors"
+
+// Download the avatar of each author of deviations into the authors directory under dirpath and
+// set it to the deviations. Each avatar is downloaded only once: deviations of the same author
+// share it and an avatar already in the archive isn't downloaded again. Failed downloads are
+// logged and the deviations are left without an avatar.
+func saveAuthorAvatars(dirpath string, deviations []djson.SavedDeviation, ctx Context) {
+	// Keyed by author, empty when the download failed.
+	avatars := map[string]string{}
+	for i := range deviations {
+		each := &deviations[i]
+		author := each.RssItem.Author
+		if each.AuthorAvatar != "" || author == "" || each.RssItem.AuthorAvatarURL == "" {
+			continue
+		}
+		avatar, exists := avatars[author]
+		if !exists {
+			avatar = saveAuthorAvatar(dirpath, author, each.RssItem.AuthorAvatarURL, ctx)
+			avatars[author] = avatar
+		}
+		each.AuthorAvatar = avatar
+	}
+}
+
+// Download author's avatar from avatarURL unless it has already been downloaded. Return the
+// avatar's filepath relative to dirpath or empty on failure.
+func saveAuthorAvatar(dirpath, author, avatarURL string, ctx Context) string {
+	name := sanitizeFilename(author)
+	// The extension may have been corrected so any is accepted.
+	if files, err := ctx.Fsys().ReadDir(filepath.Join(dirpath, authorsDirname)); err == nil {
+		for _, each := range files {
+			if strings.TrimSuffix(each.Name(), filepath.Ext(each.Name())) == name {
+				return filepath.Join(authorsDirname, each.Name())
+			}
+		}
+	}
+
+	response, err := ctx.CreateClient().Download(avatarURL)
+	if err != nil {
+		shared.Logger.Error("Failed to fetch avatar.", "url", avatarURL, "error", err)
+		return ""
+	}
+	extension, err := verifyDownload(response, MediumImage)
+	if err == nil {
+		_, err = inspectDownload(response.Body, MediumImage, djson.Dimensions{})
+	}
+	if err != nil {
+		shared.Logger.Error("Rejected avatar.", "url", avatarURL, "error", err)
+		return ""
+	}
+	relativeFilep := filepath.Join(
+		authorsDirname,
+		correctExtension(name+filepath.Ext(deriveFilename("", avatarURL)), extension))
+	absoluteFilep := filepath.Join(dirpath, relativeFilep)
+	if err := ctx.Fsys().MkdirAll(filepath.Dir(absoluteFilep), 0700); err != nil {
+		shared.Logger.Error("Failed to create path.", "filepath", absoluteFilep, "error", err)
+		return ""
+	}
+	if err := ctx.Fsys().WriteFile(absoluteFilep, response.Body, 0600); err != nil {
+		shared.Logger.Error("Failed to write avatar.", "filepath", absoluteFilep, "error", err)
+		return ""
+	}
+	return relativeFilep
+}
@@ -0,0 +1,127 @@
+package dafavorites
+
+import (
+	"path/filepath"
+	"testing"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToRssFileAuthor(t *testing.T) {
+	shared.InitTestLogging(t)
+	content := `<rss version="2.0" xmlns:media="http://search.yahoo.com/mrss/">
+		<channel>
+			<item>
+				<title>MODEL NO. TH-X11-38</title>
+				<media:credit role="author" scheme="urn:ebu">WojtekFus</media:credit>
+				<media:credit role="author" scheme="urn:ebu">
+					http://a.deviantart.net/avatars/w/o/wojtekfus.jpg?5
+				</media:credit>
+				<media:copyright url="http://wojtekfus.deviantart.com">
+					Copyright 2015 WojtekFus
+				</media:copyright>
+			</item>
+			<item>
+				<title>Avatar first</title>
+				<media:credit role="author" scheme="urn:ebu">
+					http://a.deviantart.net/avatars/w/o/wojtekfus.jpg?5
+				</media:credit>
+				<media:credit role="author" scheme="urn:ebu"> WojtekFus </media:credit>
+			</item>
+		</channel>
+	</rss>`
+
+	// EXERCISE
+	rssFile, err := toRssFile([]byte(content))
+
+	// VERIFY
+	req := require.New(t)
+	req.Nil(err)
+	req.Equal(2, len(rssFile.rssItems))
+	item := rssFile.rssItems[0]
+	req.Equal("WojtekFus", item.Author)
+	req.Equal("http://wojtekfus.deviantart.com", item.AuthorURL)
+	req.Equal("http://a.deviantart.net/avatars/w/o/wojtekfus.jpg?5", item.AuthorAvatarURL)
+	req.Equal("WojtekFus", rssFile.rssItems[1].Author, "Avatar isn't the author.")
+	req.Equal(item.AuthorAvatarURL, rssFile.rssItems[1].AuthorAvatarURL)
+}
+
+func TestFetchSavesAuthorAvatars(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	httpClient := newTestHTTPClient()
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: httpClient,
+	}
+	avatarURL := "https://a.deviantart.net/avatars/w/o/wojtekfus.jpg?5"
+	source := &testSource{
+		pages: [][]djson.RssItem{{
+			{
+				GUID:            "anna",
+				Author:          "WojtekFus",
+				AuthorAvatarURL: avatarURL,
+				URL:             "https://images-wixmp.wixmp.com/anna.jpg",
+			},
+			{
+				GUID:            "kat",
+				Author:          "WojtekFus",
+				AuthorAvatarURL: avatarURL,
+				URL:             "https://images-wixmp.com/kat.jpg",
+			},
+		}},
+		origin: djson.Origin{Kind: SourceFavorites, Username: "denarced"},
+	}
+
+	// EXERCISE
+	fetched := Fetch([]Source{source}, Options{Dirpath: dirp, WorkerCount: 2}, ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Nil(httpClient.err)
+	req.Equal(2, len(fetched.SavedDeviations))
+	expected := filepath.Join("authors", "WojtekFus.jpg")
+	for _, each := range fetched.SavedDeviations {
+		req.Equal(expected, each.AuthorAvatar)
+	}
+	verifyFileContent(req, fsys, dirp, "WojtekFus.jpg", fixtureBytes(t, avatarURL))
+	files, err := fsys.ReadDir(filepath.Join(dirp, "authors"))
+	req.Nil(err)
+	req.Equal(1, len(files))
+}
+
+func TestSaveAuthorAvatarsKeepsExisting(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	httpClient := newTestHTTPClient()
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: httpClient,
+	}
+	req := require.New(t)
+	req.Nil(fsys.WriteFile(filepath.Join(dirp, "authors", "Painter.png"), []byte("old\n"), 0600))
+	deviations := []djson.SavedDeviation{
+		{RssItem: djson.RssItem{
+			Author:          "Painter",
+			AuthorAvatarURL: "https://a.deviantart.net/avatars/missing.png",
+		}},
+		{RssItem: djson.RssItem{Author: "Nameless"}},
+		{RssItem: djson.RssItem{
+			Author:          "Failing",
+			AuthorAvatarURL: "https://a.deviantart.net/avatars/missing.png",
+		}},
+	}
+
+	// EXERCISE
+	saveAuthorAvatars(dirp, deviations, ctx)
+
+	// VERIFY
+	req.Equal(filepath.Join("authors", "Painter.png"), deviations[0].AuthorAvatar)
+	req.Equal("", deviations[1].AuthorAvatar)
+	req.Equal("", deviations[2].AuthorAvatar)
+}
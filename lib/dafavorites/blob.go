@@ -0,0 +1,80 @@
+package dafavorites
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/denarced/dafavorites/shared/shared"
+)
+
+// The directory under the archive's root for the content-addressed files.
+const blobsDirname = "blobs"
+
+// A blobStore stores files by their SHA-256 so that identical files are stored only once. The
+// files are linked to from their human-readable paths.
+type blobStore struct {
+	dirpath string
+	// Deviations are saved concurrently and they may share blobs.
+	mutex sync.Mutex
+}
+
+func newBlobStore(dirpath string) *blobStore {
+	return &blobStore{dirpath: dirpath}
+}
+
+// Store file filep, whose SHA-256 is sum, as a blob and replace filep with a link to the blob.
+// If the blob already exists, filep is only replaced with the link. Return the blob's filepath
+// relative to the archive's root, e.g. "blobs/ab/ab12...ef.jpg".
+func (v *blobStore) store(filep, sum string, ctx Context) (string, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	relativeFilep := filepath.Join(
+		blobsDirname,
+		sum[:2],
+		sum+strings.ToLower(filepath.Ext(filep)))
+	blobFilep := filepath.Join(v.dirpath, relativeFilep)
+	if _, existingSum, err := checksumFile(blobFilep, ctx); err == nil && existingSum == sum {
+		shared.Logger.Debug("Blob exists already.", "filepath", filep, "blob", relativeFilep)
+		if err := ctx.Fsys().Remove(filep); err != nil {
+			shared.Logger.Error("Failed to remove duplicate.", "filepath", filep, "error", err)
+			return "", err
+		}
+	} else {
+		// A blob that doesn't match its sum is corrupt and replaced.
+		if err := ctx.Fsys().MkdirAll(filepath.Dir(blobFilep), 0700); err != nil {
+			shared.Logger.Error("Failed to create path.", "filepath", blobFilep, "error", err)
+			return "", err
+		}
+		if err := ctx.Fsys().Rename(filep, blobFilep); err != nil {
+			shared.Logger.Error("Failed to move file to blob.", "filepath", filep, "error", err)
+			return "", err
+		}
+	}
+	if err := linkFile(blobFilep, filep, ctx); err != nil {
+		return "", err
+	}
+	return relativeFilep, nil
+}
+
+// Create file linkFilep that links to file targetFilep. A relative symbolic link is created so
+// that the archive can be moved. If the file system doesn't support symbolic links, targetFilep is
+// copied instead.
+func linkFile(targetFilep, linkFilep string, ctx Context) error {
+	err := symlink(targetFilep, linkFilep, ctx)
+	if err == nil {
+		return nil
+	}
+	shared.Logger.Warn("Failed to link file, copying it.", "filepath", linkFilep, "error", err)
+	content, err := ctx.Fsys().ReadFile(targetFilep)
+	if err != nil {
+		shared.Logger.Error("Failed to read blob.", "filepath", targetFilep, "error", err)
+		return err
+	}
+	if err := ctx.Fsys().WriteFile(linkFilep, content, 0600); err != nil {
+		shared.Logger.Error("Failed to copy blob.", "filepath", linkFilep, "error", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package dafavorites
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchContentAddressed(t *testing.T) {
+	shared.InitTestLogging(t)
+	// Symbolic links need a real file system.
+	dirp := t.TempDir()
+	fsys := &afero.Afero{Fs: afero.NewOsFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: newTestHTTPClient(),
+	}
+	source := &testSource{
+		pages: [][]djson.RssItem{{
+			createRssItem("a", annaImageURL),
+			createRssItem("b", katImageURL),
+			createRssItem("c", annaImageURL),
+		}},
+		origin: djson.Origin{Kind: SourceFavorites, Username: "david"},
+	}
+
+	// EXERCISE
+	fetched := Fetch(
+		[]Source{source},
+		Options{Dirpath: dirp, WorkerCount: 2, ContentAddressed: true},
+		ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Equal(3, len(fetched.SavedDeviations))
+	anna := fixtureBytes(t, annaImageURL)
+	annaSum := sha256Hex(string(anna))
+	annaBlob := filepath.Join(blobsDirname, annaSum[:2], annaSum+".jpg")
+	blobs := map[string]string{}
+	for _, each := range fetched.SavedDeviations {
+		blobs[each.RssItem.GUID] = each.Blob
+		info, err := os.Lstat(filepath.Join(dirp, each.Filename))
+		req.Nil(err)
+		req.NotZero(info.Mode()&os.ModeSymlink, "Should be a link: %s.", each.Filename)
+		content, err := fsys.ReadFile(filepath.Join(dirp, each.Filename))
+		req.Nil(err)
+		req.Equal(fixtureBytes(t, each.RssItem.URL), content)
+	}
+	req.Equal(annaBlob, blobs["a"])
+	req.Equal(annaBlob, blobs["c"])
+	req.NotEqual(annaBlob, blobs["b"])
+	verifyFileContent(req, fsys, dirp, filepath.Base(annaBlob), anna)
+
+	report, err := Verify(dirp, fetched, nil, ctx)
+	req.Nil(err)
+	req.True(report.OK(), "%+v", report)
+}
+
+func TestBlobStoreCopiesWithoutLinks(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{fsys: fsys}
+	req := require.New(t)
+	filep := filepath.Join(dirp, "1", "kat.jpg")
+	req.Nil(fsys.WriteFile(filep, []byte("kat"), 0600))
+
+	// EXERCISE
+	blob, err := newBlobStore(dirp).store(filep, sha256Hex("kat"), ctx)
+
+	// VERIFY
+	req.Nil(err)
+	req.Equal(filepath.Join(blobsDirname, sha256Hex("kat")[:2], sha256Hex("kat")+".jpg"), blob)
+	verifyFileContent(req, fsys, dirp, filepath.Base(blob), []byte("kat"))
+	verifyFileContent(req, fsys, dirp, "kat.jpg", []byte("kat"))
+}
@@ -0,0 +1,182 @@
+package dafavorites
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+)
+
+// VerifyReport tells how the files of an archive differ from its manifest. All filepaths are
+// relative to the archive's directory and sorted.
+type VerifyReport struct {
+	// Files in the manifest that don't exist.
+	Missing []string
+	// Files whose size or SHA-256 differs from the manifest.
+	Changed []string
+	// Files that aren't in the manifest.
+	Extra []string
+	// Files that exist but have no checksum in the manifest, e.g. ones archived before checksums
+	// were recorded.
+	Unchecked []string
+	// How many files match their checksums.
+	Verified int
+}
+
+// OK tells whether the archive matches its manifest.
+func (v VerifyReport) OK() bool {
+	return len(v.Missing) == 0 && len(v.Changed) == 0 && len(v.Extra) == 0
+}
+
+// A single file of a deviation, either the current one or a previous version.
+type deviationFile struct {
+	filename string
+	size     int64
+	sha256   string
+	blob     string
+}
+
+// List the files of deviation, the current one first.
+func listDeviationFiles(deviation djson.SavedDeviation) []deviationFile {
+	files := []deviationFile{{
+		filename: deviation.Filename,
+		size:     deviation.Size,
+		sha256:   deviation.SHA256,
+		blob:     deviation.Blob,
+	}}
+	for _, each := range deviation.PreviousVersions {
+		files = append(files, deviationFile{
+			filename: each.Filename,
+			size:     each.Size,
+			sha256:   each.SHA256,
+			blob:     each.Blob,
+		})
+	}
+	return files
+}
+
+// Derive the size and SHA-256 of file filep.
+func checksumFile(filep string, ctx Context) (int64, string, error) {
+	file, err := ctx.Fsys().Open(filep)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// SaveChecksums saves the SHA-256 of each saved deviation, and of its previous versions, to file
+// filename in the format of sha256sum, e.g. "sha256sum -c SHA256SUMS" verifies them. Files
+// without a checksum are left out.
+func SaveChecksums(deviantFetch djson.DeviantFetch, filename string) error {
+	var lines []string
+	for _, deviation := range deviantFetch.SavedDeviations {
+		for _, each := range listDeviationFiles(deviation) {
+			if each.sha256 == "" {
+				continue
+			}
+			lines = append(lines, each.sha256+"  "+filepath.ToSlash(each.filename)+"\n")
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i][sha256.Size*2:] < lines[j][sha256.Size*2:]
+	})
+	if err := os.WriteFile(filename, []byte(strings.Join(lines, "")), 0644); err != nil {
+		shared.Logger.Error("Error writing checksums.", "filename", filename, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Verify checks the files of the archive in directory dirpath against its manifest deviantFetch.
+// Files in ignored, e.g. the manifest itself, aren't reported as extra. Previous versions of
+// deviations are checked like the current ones. Authors' avatars have no checksums so they're
+// only checked for existence. Blobs are checked through the files that link to them and views
+// aren't checked at all.
+func Verify(
+	dirpath string,
+	deviantFetch djson.DeviantFetch,
+	ignored []string,
+	ctx Context,
+) (VerifyReport, error) {
+	report := VerifyReport{}
+	known := map[string]bool{}
+	for _, each := range ignored {
+		known[filepath.Clean(each)] = true
+	}
+	for _, deviation := range deviantFetch.SavedDeviations {
+		avatar := deviation.AuthorAvatar
+		if avatar != "" && !known[filepath.Clean(avatar)] {
+			known[filepath.Clean(avatar)] = true
+			if exists, _ := ctx.Fsys().Exists(filepath.Join(dirpath, avatar)); !exists {
+				report.Missing = append(report.Missing, avatar)
+			}
+		}
+		for _, each := range listDeviationFiles(deviation) {
+			// Blobs are verified through the links to them.
+			if each.blob != "" {
+				known[filepath.Clean(each.blob)] = true
+			}
+			if each.filename == "" || known[filepath.Clean(each.filename)] {
+				continue
+			}
+			known[filepath.Clean(each.filename)] = true
+			size, sum, err := checksumFile(filepath.Join(dirpath, each.filename), ctx)
+			switch {
+			case os.IsNotExist(err):
+				report.Missing = append(report.Missing, each.filename)
+			case err != nil:
+				shared.Logger.Error("Failed to read file.", "filename", each.filename, "error", err)
+				return VerifyReport{}, err
+			case each.sha256 == "":
+				report.Unchecked = append(report.Unchecked, each.filename)
+			case size != each.size || sum != each.sha256:
+				report.Changed = append(report.Changed, each.filename)
+			default:
+				report.Verified++
+			}
+		}
+	}
+
+	err := ctx.Fsys().Walk(dirpath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(dirpath, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// Views only link to the archive's files.
+			if relative == viewsDirname {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !known[relative] {
+			report.Extra = append(report.Extra, relative)
+		}
+		return nil
+	})
+	if err != nil {
+		shared.Logger.Error("Failed to list archive.", "dirpath", dirpath, "error", err)
+		return VerifyReport{}, fmt.Errorf("failed to list %s: %w", dirpath, err)
+	}
+	sort.Strings(report.Missing)
+	sort.Strings(report.Changed)
+	sort.Strings(report.Extra)
+	sort.Strings(report.Unchecked)
+	return report, nil
+}
@@ -0,0 +1,150 @@
+package dafavorites
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchRecordsChecksums(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: newTestHTTPClient(),
+	}
+	source := &testSource{
+		pages:  [][]djson.RssItem{{createRssItem("kat", katImageURL)}},
+		origin: djson.Origin{Kind: SourceFavorites, Username: "denarced"},
+	}
+
+	// EXERCISE
+	fetched := Fetch([]Source{source}, Options{Dirpath: dirp, WorkerCount: 1}, ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Equal(1, len(fetched.SavedDeviations))
+	kat := fixtureBytes(t, katImageURL)
+	sum := sha256.Sum256(kat)
+	req.Equal(int64(len(kat)), fetched.SavedDeviations[0].Size)
+	req.Equal(hex.EncodeToString(sum[:]), fetched.SavedDeviations[0].SHA256)
+}
+
+// Fails to open any file for reading.
+type unreadableFs struct {
+	afero.Fs
+}
+
+func (unreadableFs) Open(string) (afero.File, error) {
+	return nil, os.ErrPermission
+}
+
+func TestFetchWithoutChecksum(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	fsys := &afero.Afero{Fs: unreadableFs{Fs: afero.NewMemMapFs()}}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: newTestHTTPClient(),
+	}
+	source := &testSource{
+		pages:  [][]djson.RssItem{{createRssItem("kat", katImageURL)}},
+		origin: djson.Origin{Kind: SourceFavorites, Username: "denarced"},
+	}
+
+	// EXERCISE
+	fetched := Fetch([]Source{source}, Options{Dirpath: dirp, WorkerCount: 1}, ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Equal(1, len(fetched.SavedDeviations), "Saved file should be listed.")
+	req.Equal(int64(0), fetched.SavedDeviations[0].Size)
+	req.Equal("", fetched.SavedDeviations[0].SHA256)
+	exists, err := fsys.Exists(filepath.Join(dirp, fetched.SavedDeviations[0].Filename))
+	req.Nil(err)
+	req.True(exists)
+}
+
+func TestSaveChecksums(t *testing.T) {
+	filep := filepath.Join(t.TempDir(), "SHA256SUMS")
+	deviantFetch := djson.DeviantFetch{
+		SavedDeviations: []djson.SavedDeviation{
+			{Filename: filepath.Join("b", "kat.jpg"), SHA256: sha256Hex("kat")},
+			{Filename: "old.jpg"},
+			{Filename: filepath.Join("a", "anna.jpg"), SHA256: sha256Hex("anna")},
+		},
+	}
+
+	// EXERCISE
+	err := SaveChecksums(deviantFetch, filep)
+
+	// VERIFY
+	req := require.New(t)
+	req.Nil(err)
+	content, err := os.ReadFile(filep)
+	req.Nil(err)
+	req.Equal(
+		sha256Hex("anna")+"  a/anna.jpg\n"+sha256Hex("kat")+"  b/kat.jpg\n",
+		string(content))
+}
+
+func TestVerify(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{fsys: fsys}
+	req := require.New(t)
+	for _, each := range []struct {
+		filename string
+		content  string
+	}{
+		{"deviantFetch.json", "{}"},
+		{filepath.Join("authors", "Painter.jpg"), "avatar"},
+		{filepath.Join("1", "ok.jpg"), "ok"},
+		{filepath.Join("2", "changed.jpg"), "changed!"},
+		{filepath.Join("3", "old.jpg"), "old"},
+		{filepath.Join("4", "extra.jpg"), "extra"},
+	} {
+		writeArchiveFile(req, fsys, dirp, each.filename, []byte(each.content))
+	}
+	deviantFetch := djson.DeviantFetch{
+		SavedDeviations: []djson.SavedDeviation{
+			createSavedDeviation(filepath.Join("1", "ok.jpg"), "", []byte("ok")),
+			createSavedDeviation(filepath.Join("2", "changed.jpg"), "", []byte("changed")),
+			createSavedDeviation(filepath.Join("5", "missing.jpg"), "", []byte("missing")),
+			createSavedDeviation(filepath.Join("3", "old.jpg"), "", nil),
+		},
+	}
+	for i := range deviantFetch.SavedDeviations {
+		deviantFetch.SavedDeviations[i].AuthorAvatar = filepath.Join("authors", "Painter.jpg")
+	}
+
+	// EXERCISE
+	report, err := Verify(dirp, deviantFetch, []string{"deviantFetch.json"}, ctx)
+
+	// VERIFY
+	req.Nil(err)
+	req.Equal(
+		VerifyReport{
+			Missing:   []string{filepath.Join("5", "missing.jpg")},
+			Changed:   []string{filepath.Join("2", "changed.jpg")},
+			Extra:     []string{filepath.Join("4", "extra.jpg")},
+			Unchecked: []string{filepath.Join("3", "old.jpg")},
+			Verified:  1,
+		},
+		report)
+	req.False(report.OK())
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,76 @@
+package dafavorites
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+)
+
+const (
+	collectionFoldersURL = "https://www.deviantart.com/_puppy/dashared/gallection/folders"
+	collectionPageSize   = 50
+)
+
+// FetchCollections lists user username's favorites collections.
+func FetchCollections(username string, ctx Context) ([]djson.CollectionFolder, error) {
+	var folders []djson.CollectionFolder
+	offset := 0
+	for {
+		page, err := fetchCollectionPage(username, offset, ctx)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, page.Results...)
+		// Guard against a next offset that doesn't move forward, it'd never end.
+		if !page.HasMore || page.NextOffset <= offset {
+			break
+		}
+		offset = page.NextOffset
+	}
+	shared.Logger.Info("Collections listed.", "username", username, "count", len(folders))
+	return folders, nil
+}
+
+func fetchCollectionPage(
+	username string,
+	offset int,
+	ctx Context,
+) (djson.CollectionFolders, error) {
+	query := url.Values{}
+	query.Set("username", username)
+	query.Set("type", "collection")
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(collectionPageSize))
+	pageURL := collectionFoldersURL + "?" + query.Encode()
+
+	shared.Logger.Debug("About to fetch collections.", "url", pageURL)
+	bytes, err := ctx.CreateClient().Fetch(pageURL)
+	if err != nil {
+		shared.Logger.Error("Failed to fetch collections.", "url", pageURL, "error", err)
+		return djson.CollectionFolders{}, err
+	}
+	var page djson.CollectionFolders
+	if err := json.Unmarshal(bytes, &page); err != nil {
+		shared.Logger.Error("Failed to parse collections.", "url", pageURL, "error", err)
+		return djson.CollectionFolders{}, fmt.Errorf("invalid collection listing: %w", err)
+	}
+	return page, nil
+}
+
+// NewCollectionSource creates a Source for the deviations in user username's favorites
+// collection folder.
+func NewCollectionSource(username string, folder djson.CollectionFolder) Source {
+	folderID := strconv.FormatInt(folder.FolderID, 10)
+	return NewRssSource(
+		buildRssURL("favby:"+username+"/"+folderID),
+		djson.Origin{
+			Kind:           SourceFavorites,
+			Username:       username,
+			CollectionID:   folderID,
+			CollectionName: folder.Name,
+		})
+}
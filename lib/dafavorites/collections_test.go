@@ -0,0 +1,70 @@
+package dafavorites
+
+import (
+	"path/filepath"
+	"testing"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchCollections(t *testing.T) {
+	shared.InitTestLogging(t)
+	httpClient := newTestHTTPClient()
+	ctx := &TestContext{
+		fsys:       &afero.Afero{Fs: afero.NewMemMapFs()},
+		httpClient: httpClient,
+	}
+
+	// EXERCISE
+	folders, err := FetchCollections("denarced", ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Nil(err)
+	req.Nil(httpClient.err)
+	req.Equal(
+		[]djson.CollectionFolder{
+			{FolderID: 123, Name: "Cats/Dogs"},
+			{FolderID: 456, Name: "Landscapes"},
+		},
+		folders)
+}
+
+func TestFetchByCollection(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: newTestHTTPClient(),
+	}
+	source := NewCollectionSource(
+		"denarced",
+		djson.CollectionFolder{FolderID: 123, Name: "Cats/Dogs"})
+
+	// EXERCISE
+	fetched := Fetch(
+		[]Source{source},
+		Options{Dirpath: dirp, WorkerCount: 1, ByCollection: true},
+		ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Equal(1, len(fetched.SavedDeviations))
+	deviation := fetched.SavedDeviations[0]
+	ass := assert.New(t)
+	ass.Equal(
+		[]djson.Origin{{
+			Kind:           SourceFavorites,
+			Username:       "denarced",
+			CollectionID:   "123",
+			CollectionName: "Cats/Dogs",
+		}},
+		deviation.Origins)
+	ass.Equal("Cats_Dogs", filepath.Dir(filepath.Dir(deviation.Filename)))
+	verifyFileContent(req, fsys, filepath.Join(dirp, "Cats_Dogs"), "kat.jpg", fixtureBytes(t, katImageURL))
+}
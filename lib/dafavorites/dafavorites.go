@@ -4,11 +4,13 @@ package dafavorites
 import (
 	"crypto/rand"
 	"encoding/json"
-	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -20,20 +22,113 @@ import (
 )
 
 const (
-	baseRss = "http://backend.deviantart.com/rss.xml" +
-		"?q=favby%3A___usern___&type=deviation"
+	// TruncatedCycle means that the listing stopped because the next page had been read already.
+	TruncatedCycle = "cycle"
+	// TruncatedMaxPages means that the listing stopped at the maximum number of pages.
+	TruncatedMaxPages = "max-pages"
+	// TruncatedMaxItems means that the listing stopped at the maximum number of items.
+	TruncatedMaxItems = "max-items"
+	// TruncatedError means that the listing stopped because of an error.
+	TruncatedError = "error"
+	// TruncatedKnown means that the listing stopped at a deviation already in the archive.
+	TruncatedKnown = "known"
+	// TruncatedSince means that the listing stopped at a deviation older than the cutoff.
+	TruncatedSince = "since"
+)
+
+var (
+	// ErrPaginationCycle is returned by a Source when its next page would be one it has already
+	// provided.
+	ErrPaginationCycle = errors.New("pagination cycle")
+	// ErrLimitReached is returned by a Source that stops before its end because of a limit.
+	ErrLimitReached = errors.New("limit reached")
+)
+
+const (
+	baseRss = "http://backend.deviantart.com/rss.xml"
+	// How many sources are read at the same time.
+	maxConcurrentSources = 4
 )
 
 // HTTPClient .
 type HTTPClient interface {
 	Fetch(url string) ([]byte, error)
+	// Download url like Fetch but with the response's metadata. Responses with any status code
+	// are returned without an error.
+	Download(url string) (Response, error)
+}
+
+// Response of HTTPClient's Download.
+type Response struct {
+	Body       []byte
+	StatusCode int
+	// Header Content-Type, e.g. "image/jpeg". Empty when missing.
+	ContentType string
+	// Header Content-Length, -1 when unknown.
+	ContentLength int64
 }
 
 // Context for the whole thing.
 type Context interface {
 	CreateClient() HTTPClient
 	Fsys() *afero.Afero
-	Username() string
+	Usernames() []string
+}
+
+// Options for a single fetch.
+type Options struct {
+	// Dirpath is the root dir of the archive into which deviations are downloaded.
+	Dirpath string
+	// WorkerCount is the number of images downloaded in parallel. Must be at least 1.
+	WorkerCount int
+	// ByCollection places deviations found in a favorites collection in a sub directory named
+	// after the collection.
+	ByCollection bool
+	// MaxPages is the maximum number of pages read from each source, 0 for no limit.
+	MaxPages int
+	// MaxItems is the maximum number of items read from each source, 0 for no limit.
+	MaxItems int
+	// Previous is the archive's previous fetch, nil if there's none. Its deviations aren't
+	// downloaded again and they are included in the end result.
+	Previous *djson.DeviantFetch
+	// StopAtKnown stops reading a source at the first deviation that the previous fetch
+	// already had from the same source.
+	StopAtKnown bool
+	// Since skips deviations published before it, zero for no limit. Sources listed by
+	// publication date, i.e. galleries and searches sorted by time, are read only until the
+	// first such deviation. Others, e.g. favorites that are listed in the order they were
+	// favorited, are read to the end.
+	Since time.Time
+	// Filter decides which deviations are downloaded, nil for all of them.
+	Filter *Filter
+	// ContentAddressed stores each file once in a blob named after its SHA-256 and links to the
+	// blob from the deviation's own path. Identical files are thus stored only once.
+	ContentAddressed bool
+}
+
+// FetchResult is what's known once all sources have been read.
+type fetchResult struct {
+	// Origins of each deviation, keyed by deviationKey.
+	origins  map[string][]djson.Origin
+	listings []djson.Listing
+	skipped  []djson.SkippedDeviation
+	// The items of deviations already in the archive as they were found now, keyed by
+	// deviationKey.
+	seen map[string]djson.RssItem
+	// Where each deviation was listed, keyed by deviationKey.
+	positions map[string][]djson.Position
+}
+
+// FetchJob is a single deviation to download and the source it came from.
+type fetchJob struct {
+	rssItem djson.RssItem
+	origin  djson.Origin
+	// The page that the deviation was listed on and its position in the whole listing, both
+	// starting from 1.
+	page     int
+	position int
+	// True when the deviation was published before Options.Since.
+	beforeSince bool
 }
 
 // RssFile is the items of the one Deviant Art RSS file and the next one's URL
@@ -50,27 +145,74 @@ func itemElementsToItems(elements []dxml.RssItemElement) []djson.RssItem {
 
 	rssItems := make([]djson.RssItem, 0, len(elements))
 	for _, each := range elements {
+		title := each.Title
+		if title == "" {
+			title = each.MediaTitle
+		}
+		content := pickContent(each.Contents, each.Groups)
+		if content.URL == "" && len(each.Enclosures) > 0 {
+			content.URL = each.Enclosures[0].URL
+			content.Type = each.Enclosures[0].Type
+		}
+		// Plain <description> has a thumbnail appended to it.
+		description, descriptionMarkdown := CleanDescription(
+			firstNonEmpty(each.MediaDescription, each.Description))
+		medium, text := deriveMediumAndText(
+			content,
+			each.Text,
+			each.MediaDescription,
+			each.Description)
 		rssItems = append(
 			rssItems,
 			djson.RssItem{
-				Title:           each.Title,
+				Title:           title,
 				Link:            each.Link,
 				GUID:            each.GUID,
 				PublicationDate: each.PublicationDate,
-				Author:          extractAuthor(each.Credits),
-				URL:             each.Content.URL,
+				Author:          firstNonEmpty(extractAuthor(each.Credits), each.Creator, each.Author),
+				AuthorURL:       strings.TrimSpace(each.Copyright.URL),
+				AuthorAvatarURL: extractAvatar(each.Credits),
+				URL:             content.URL,
 				Dimensions: djson.Dimensions{
-					Width:  each.Content.Width,
-					Height: each.Content.Height}})
+					Width:  content.Width,
+					Height: content.Height},
+				Rating:              strings.TrimSpace(each.Rating),
+				Category:            strings.TrimSpace(each.Category.Value),
+				CategoryLabel:       each.Category.Label,
+				License:             newLicense(each.License),
+				Description:         description,
+				DescriptionMarkdown: descriptionMarkdown,
+				Medium:              medium,
+				Text:                text})
 	}
 	return rssItems
 }
 
+func firstNonEmpty(values ...string) string {
+	for _, each := range values {
+		if each != "" {
+			return each
+		}
+	}
+	return ""
+}
+
 func extractAuthor(credits []dxml.ItemCreditElement) string {
 	for _, eachCredit := range credits {
-		if eachCredit.Role == "author" &&
-			!strings.HasPrefix(eachCredit.Value, "http") {
-			return eachCredit.Value
+		value := strings.TrimSpace(eachCredit.Value)
+		if eachCredit.Role == "author" && !strings.HasPrefix(value, "http") {
+			return value
+		}
+	}
+	return ""
+}
+
+// Extract the author's avatar URL, which Deviant Art gives as a second author credit.
+func extractAvatar(credits []dxml.ItemCreditElement) string {
+	for _, eachCredit := range credits {
+		value := strings.TrimSpace(eachCredit.Value)
+		if eachCredit.Role == "author" && strings.HasPrefix(value, "http") {
+			return value
 		}
 	}
 	return ""
@@ -78,9 +220,8 @@ func extractAuthor(credits []dxml.ItemCreditElement) string {
 
 // ToRssFile converts reader contents to an rssFile
 func toRssFile(contentBytes []byte) (rssFile, error) {
-	rssElement := dxml.RssElement{}
-	if err := xml.Unmarshal(contentBytes, &rssElement); err != nil {
-		shared.Logger.Error("Failed to unmarshal XML.", "error", err)
+	rssElement, err := decodeRss(contentBytes)
+	if err != nil {
 		return rssFile{}, err
 	}
 	rssItems := itemElementsToItems(rssElement.Channel.RssItems)
@@ -132,37 +273,61 @@ type downloadParams struct {
 	dryRun bool
 	// UUID to act as a sub dir under Dirname.
 	uuid string
-	// Filename for the image.
+	// Filename for the image. The extension is corrected to match what's downloaded.
 	filename string
+	// The medium expected to be downloaded, e.g. "image".
+	medium string
+	// The size of the image in the feed.
+	dimensions djson.Dimensions
 }
 
 // Download file params.url with params as a specification.
 // Return the downloaded file's filepath.
-func downloadImages(params downloadParams, ctx Context) string {
+func downloadImages(params downloadParams, ctx Context) (string, *djson.ImageInfo) {
 	fpath := filepath.Join(params.dirname, params.uuid, params.filename)
 	if params.dryRun {
 		shared.Logger.Debug("Dry run: skip download.", "filepath", fpath)
-		return ""
-	}
-	dirpath := filepath.Join(params.dirname, params.uuid)
-	if err := ctx.Fsys().MkdirAll(dirpath, 0700); err != nil {
-		shared.Logger.Error("Failed to create path.", "dirpath", dirpath, "error", err)
-		return ""
+		return "", nil
 	}
 
 	httpClient := ctx.CreateClient()
-	imageBytes, err := httpClient.Fetch(params.url)
+	response, err := httpClient.Download(params.url)
 	if err != nil {
 		shared.Logger.Error("Failed to fetch image.", "error", err)
-		return ""
+		return "", nil
+	}
+	shared.Logger.Debug("Fetched image.", "filepath", fpath, "size", len(response.Body))
+	extension, err := verifyDownload(response, params.medium)
+	if err != nil {
+		shared.Logger.Error("Rejected download.", "url", params.url, "error", err)
+		return "", nil
+	}
+	imageInfo, err := inspectDownload(response.Body, params.medium, params.dimensions)
+	if err != nil {
+		shared.Logger.Error("Rejected download.", "url", params.url, "error", err)
+		return "", nil
 	}
-	imageSize := int64(len(imageBytes))
-	shared.Logger.Debug("Fetched image.", "filepath", fpath, "size", imageSize)
-	if imageSize <= 0 {
-		return ""
+	if imageInfo != nil && imageInfo.DimensionsMismatch {
+		shared.Logger.Warn(
+			"Image size differs from the feed.",
+			"url",
+			params.url,
+			"actual",
+			fmt.Sprintf("%dx%d", imageInfo.Width, imageInfo.Height),
+			"feed",
+			fmt.Sprintf("%dx%d", params.dimensions.Width, params.dimensions.Height))
 	}
+	fpath = filepath.Join(
+		params.dirname,
+		params.uuid,
+		correctExtension(params.filename, extension))
 
-	if err := ctx.Fsys().WriteFile(fpath, imageBytes, 0600); err != nil {
+	dirpath := filepath.Join(params.dirname, params.uuid)
+	if err := ctx.Fsys().MkdirAll(dirpath, 0700); err != nil {
+		shared.Logger.Error("Failed to create path.", "dirpath", dirpath, "error", err)
+		return "", nil
+	}
+	if err := ctx.Fsys().WriteFile(fpath, response.Body, 0600); err != nil {
 		shared.Logger.Error(
 			"Failed to copy image to file.",
 			"filepath",
@@ -170,10 +335,10 @@ func downloadImages(params downloadParams, ctx Context) string {
 			"error",
 			err,
 		)
-		return ""
+		return "", nil
 	}
 	defer shared.Logger.Debug("Deviation downloaded.", "filepath", fpath)
-	return fpath
+	return fpath, imageInfo
 }
 
 func deriveFilename(prefix, url string) string {
@@ -191,43 +356,265 @@ func deriveFilename(prefix, url string) string {
 	return prefix + separator + extraPieces[0]
 }
 
-func fetchAndReadRss(url string, ctx Context) (rssFile, error) {
-	bytes, err := fetchRssFile(url, ctx)
-	if err != nil {
-		return rssFile{}, err
+// Fetch items from sources and pass the deviations to be downloaded. The
+// sources are read concurrently and each distinct deviation is passed to
+// jobChan only once, no matter how many sources provide it. Once done, the
+// origins of all deviations and the listings of sources are passed to
+// resultChan to signal that work is done.
+func fetchItems(
+	sources []Source,
+	options Options,
+	jobChan chan fetchJob,
+	resultChan chan fetchResult,
+	ctx Context) {
+	index := newArchiveIndex(options.Previous)
+	sourceJobChan := make(chan fetchJob)
+	listings := make([]djson.Listing, len(sources))
+	waitGroup := sync.WaitGroup{}
+	semaphore := make(chan struct{}, maxConcurrentSources)
+	for i, each := range sources {
+		waitGroup.Add(1)
+		go func(i int, source Source) {
+			defer waitGroup.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			// Each goroutine writes only to its own index.
+			listings[i] = fetchSourceItems(source, options, index, sourceJobChan, ctx)
+		}(i, each)
+	}
+	go func() {
+		waitGroup.Wait()
+		close(sourceJobChan)
+	}()
+
+	origins := map[string][]djson.Origin{}
+	seen := map[string]djson.RssItem{}
+	positions := map[string][]djson.Position{}
+	var skipped []djson.SkippedDeviation
+	for job := range sourceJobChan {
+		key := deviationKey(job.rssItem)
+		positions[key] = append(
+			positions[key],
+			djson.Position{Origin: job.origin, Page: job.page, Position: job.position})
+		if existing, found := origins[key]; found {
+			shared.Logger.Debug("Deviation already queued.", "key", key)
+			origins[key] = appendOrigin(existing, job.origin)
+			continue
+		}
+		origins[key] = []djson.Origin{job.origin}
+		if index.contains(key) {
+			seen[key] = job.rssItem
+			if !index.isReplaced(key, job.rssItem) {
+				shared.Logger.Debug("Deviation already in archive.", "key", key)
+				continue
+			}
+			// Downloaded as a new version even if it no longer passes the filter.
+			shared.Logger.Info("Deviation's image replaced.", "key", key)
+			jobChan <- job
+			continue
+		}
+		if job.beforeSince {
+			shared.Logger.Debug("Deviation published before since.", "key", key)
+			skipped = append(
+				skipped,
+				djson.SkippedDeviation{
+					RssItem: job.rssItem,
+					Reason:  "since: " + options.Since.Format(time.RFC3339),
+				})
+			continue
+		}
+		if options.Filter != nil {
+			if ok, reason := options.Filter.Match(job.rssItem); !ok {
+				shared.Logger.Debug("Deviation filtered out.", "key", key, "reason", reason)
+				skipped = append(
+					skipped,
+					djson.SkippedDeviation{RssItem: job.rssItem, Reason: reason})
+				continue
+			}
+		}
+		jobChan <- job
+	}
+	resultChan <- fetchResult{
+		origins:   origins,
+		listings:  listings,
+		skipped:   skipped,
+		seen:      seen,
+		positions: positions,
 	}
-	return toRssFile(bytes)
 }
 
-// Fetch RSS files and pass the deviations to be downloaded. The RSSs are
-// fetched for user username and each deviation is passed to rssItemChan. Once
-// done, the channel finished is closed to signal that work is done.
-func fetchRss(
-	rssItemChan chan djson.RssItem,
-	finished chan struct{},
-	ctx Context) {
-	defer close(finished)
+// Derive the key that identifies a deviation regardless of where it was found.
+func deviationKey(item djson.RssItem) string {
+	if item.GUID != "" {
+		return item.GUID
+	}
+	if item.Link != "" {
+		return item.Link
+	}
+	return item.URL
+}
 
-	url := strings.Replace(baseRss, "___usern___", ctx.Username(), 1)
-	rssFile, err := fetchAndReadRss(url, ctx)
-	if err != nil {
-		return
+func appendOrigin(origins []djson.Origin, origin djson.Origin) []djson.Origin {
+	for _, each := range origins {
+		if each == origin {
+			return origins
+		}
+	}
+	return append(origins, origin)
+}
+
+// Derive the sorted usernames of the users who have favorited a deviation found
+// in origins.
+func deriveFavoritedBy(origins []djson.Origin) []string {
+	var usernames []string
+	for _, each := range origins {
+		if each.Kind != SourceFavorites || slices.Contains(usernames, each.Username) {
+			continue
+		}
+		usernames = append(usernames, each.Username)
 	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+// Read source until it ends or a limit in options is reached. Each item is
+// passed to jobChan. Return how far the source was read.
+func fetchSourceItems(
+	source Source,
+	options Options,
+	index archiveIndex,
+	jobChan chan fetchJob,
+	ctx Context,
+) djson.Listing {
+	origin := source.Origin()
+	listing := djson.Listing{Origin: origin}
 	for {
-		// Pass favorite deviations to be downloaded
-		for _, each := range rssFile.rssItems {
-			rssItemChan <- each
+		// A source that ends exactly at a limit is complete rather than truncated.
+		if options.MaxPages > 0 && listing.Pages >= options.MaxPages {
+			listing.Complete = !hasNextPage(source)
+			if !listing.Complete {
+				listing.Reason = TruncatedMaxPages
+			}
+			break
 		}
-		// Fetch more deviations if there are some
-		if len(rssFile.nextURL) == 0 {
+		if options.MaxItems > 0 && listing.Items >= options.MaxItems {
+			listing.Complete = !hasNextPage(source)
+			if !listing.Complete {
+				listing.Reason = TruncatedMaxItems
+			}
+			break
+		}
+		items, err := source.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			listing.Complete = true
 			break
 		}
-
-		rssFile, err = fetchAndReadRss(rssFile.nextURL, ctx)
 		if err != nil {
-			return
+			listing.Reason = deriveTruncationReason(err)
+			if listing.Reason == TruncatedError {
+				listing.Error = err.Error()
+			}
+			shared.Logger.Error(
+				"Failed to read items from source.",
+				"kind",
+				origin.Kind,
+				"username",
+				origin.Username,
+				"query",
+				origin.Query,
+				"error",
+				err)
+			break
+		}
+		listing.Pages++
+		for i, each := range items {
+			if reason := deriveStopReason(each, origin, options, index); reason != "" {
+				items = items[:i]
+				listing.Reason = reason
+				break
+			}
+		}
+		if remaining := options.MaxItems - listing.Items; options.MaxItems > 0 &&
+			len(items) > remaining {
+			items = items[:remaining]
+			listing.Reason = TruncatedMaxItems
+		}
+		listing.Items += len(items)
+		// Pass deviations to be downloaded
+		for i, each := range items {
+			jobChan <- fetchJob{
+				rssItem:     each,
+				origin:      origin,
+				page:        listing.Pages,
+				position:    listing.Items - len(items) + i + 1,
+				beforeSince: isPublishedBefore(each, options.Since),
+			}
+		}
+		if listing.Reason != "" {
+			break
 		}
 	}
+	if !listing.Complete {
+		shared.Logger.Info(
+			"Listing truncated.",
+			"kind",
+			origin.Kind,
+			"username",
+			origin.Username,
+			"query",
+			origin.Query,
+			"reason",
+			listing.Reason)
+	}
+	return listing
+}
+
+// Derive why reading a source should stop at item, empty if it shouldn't.
+func deriveStopReason(
+	item djson.RssItem,
+	origin djson.Origin,
+	options Options,
+	index archiveIndex,
+) string {
+	if options.StopAtKnown && index.containsFrom(origin, deviationKey(item)) {
+		return TruncatedKnown
+	}
+	if isPublicationOrdered(origin) && isPublishedBefore(item, options.Since) {
+		return TruncatedSince
+	}
+	return ""
+}
+
+// Tell whether item was published before since. False when since is zero or the publication
+// date is unknown.
+func isPublishedBefore(item djson.RssItem, since time.Time) bool {
+	if since.IsZero() {
+		return false
+	}
+	published, ok := parsePublicationDate(item.PublicationDate)
+	return ok && published.Before(since)
+}
+
+// Tell whether origin lists deviations from the most recently published. Favorites, for one, are
+// listed in the order they were favorited.
+func isPublicationOrdered(origin djson.Origin) bool {
+	switch origin.Kind {
+	case SourceGallery:
+		return true
+	case SourceSearch:
+		return strings.Contains(origin.Query, "sort:time")
+	}
+	return false
+}
+
+func deriveTruncationReason(err error) string {
+	if errors.Is(err, ErrPaginationCycle) {
+		return TruncatedCycle
+	}
+	if errors.Is(err, ErrLimitReached) {
+		return TruncatedMaxItems
+	}
+	return TruncatedError
 }
 
 func fetchRssFile(url string, ctx Context) (bytes []byte, err error) {
@@ -240,26 +627,28 @@ func fetchRssFile(url string, ctx Context) (bytes []byte, err error) {
 	return
 }
 
-// Download and save deviations. Jobs are received from rssItemChan and results
+// Download and save deviations. Jobs are received from jobChan and results
 // are passed to savedDeviationChan. Parameter id is the identifier and it isn't
 // functional. It'll be used merely in any logging or printouts. Once the
-// channel rssItemChan no longer provides jobs to perform, waitGroup.Done() is
+// channel jobChan no longer provides jobs to perform, waitGroup.Done() is
 // called in order to inform the caller that this method has completed. If
 // dryRun is true, nothing is really downloaded but otherwise the process is
 // executed in a normal fashion.
 func saveDeviations(
 	id int,
-	dirpath string,
-	rssItemChan chan djson.RssItem,
+	options Options,
+	jobChan chan fetchJob,
 	savedDeviationChan chan djson.SavedDeviation,
 	waitGroup *sync.WaitGroup,
 	dryRun bool,
+	store *blobStore,
 	ctx Context,
 ) {
 	defer waitGroup.Done()
 
 	shared.Logger.Debug("Starting download worker.", "ID", id)
-	for each := range rssItemChan {
+	for job := range jobChan {
+		each := job.rssItem
 		shared.Logger.Debug(
 			"Worker about to start downloading.",
 			"id",
@@ -275,20 +664,29 @@ func saveDeviations(
 		}
 		filename := deriveFilename("", each.URL)
 		params := downloadParams{
-			dirname:  dirpath,
-			url:      each.URL,
-			dryRun:   dryRun,
-			uuid:     uuid,
-			filename: filename,
+			dirname:    deriveDeviationDirpath(options, job.origin),
+			url:        each.URL,
+			dryRun:     dryRun,
+			uuid:       uuid,
+			filename:   filename,
+			medium:     each.Medium,
+			dimensions: each.Dimensions,
+		}
+		var absoluteFilep string
+		var imageInfo *djson.ImageInfo
+		if each.Medium == MediumLiterature && each.URL == "" {
+			shared.Logger.Debug("Worker: save literature.", "id", id, "title", each.Title)
+			absoluteFilep = saveLiterature(filepath.Join(params.dirname, params.uuid), each, ctx)
+		} else {
+			shared.Logger.Debug("Worker: download image.", "id", id, "url", params.url)
+			absoluteFilep, imageInfo = downloadImages(params, ctx)
 		}
-		shared.Logger.Debug("Worker: download image.", "id", id, "url", params.url)
-		absoluteFilep := downloadImages(params, ctx)
 		if len(absoluteFilep) == 0 {
 			// Nothing to be done if the download failed as the error should
 			// have been reported by the called function.
 			continue
 		}
-		relativeFilep, err := filepath.Rel(dirpath, absoluteFilep)
+		relativeFilep, err := filepath.Rel(options.Dirpath, absoluteFilep)
 		if err != nil {
 			// If this fails, it'll probably fail for all deviations. Thus, might as well just
 			// panic.
@@ -299,19 +697,61 @@ func saveDeviations(
 				"absolute path",
 				absoluteFilep,
 				"base path",
-				dirpath,
+				options.Dirpath,
 			)
 			panic("Failed to derive relative filepath.")
 		}
+		size, sum, err := checksumFile(absoluteFilep, ctx)
+		if err != nil {
+			// The file is saved already, better to list it without a checksum than not at all.
+			shared.Logger.Error("Failed to checksum file.", "filepath", absoluteFilep, "error", err)
+		}
+		var blob string
+		// Blobs are named by their checksum.
+		if store != nil && sum != "" {
+			blob, err = store.store(absoluteFilep, sum, ctx)
+			if err != nil {
+				continue
+			}
+		}
 		savedDeviationChan <- djson.SavedDeviation{
 			RssItem:  each,
 			Filename: relativeFilep,
+			Size:     size,
+			SHA256:   sum,
+			Blob:     blob,
+			Origins:  []djson.Origin{job.origin},
+			Image:    imageInfo,
 		}
 	}
 
 	shared.Logger.Info("Quitting download worker.", "id", id)
 }
 
+// Derive the directory under which a deviation from origin is downloaded.
+func deriveDeviationDirpath(options Options, origin djson.Origin) string {
+	if !options.ByCollection || origin.CollectionName == "" {
+		return options.Dirpath
+	}
+	return filepath.Join(options.Dirpath, sanitizeFilename(origin.CollectionName))
+}
+
+// Make name safe to be used as a single file or directory name.
+func sanitizeFilename(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	// Hidden files, "." and ".." aren't wanted.
+	sanitized = strings.TrimLeft(sanitized, ".")
+	if sanitized == "" {
+		return "_"
+	}
+	return sanitized
+}
+
 // Collected downloaded deviations into a single DeviantFetch. The deviations
 // are received from savedDeviationChan and the end result is passed to
 // deviantFetchChan.
@@ -330,27 +770,42 @@ func collectSavedDeviations(
 	}
 }
 
-// FetchFavorites fetches user username's favorite deviations to directory dirpath. Several
-// images can be downloaded in parallel according to dlWorkerCount. It's value
+// FetchFavorites fetches the favorite deviations of all users in the context to directory
+// dirpath. Several images can be downloaded in parallel according to dlWorkerCount. It's value
 // must be at least 1. Return information on all fetched deviations.
 func FetchFavorites(dirpath string, dlWorkerCount int, ctx Context) djson.DeviantFetch {
+	var sources []Source
+	for _, each := range ctx.Usernames() {
+		sources = append(sources, NewFavoritesSource(each))
+	}
+	return Fetch(sources, Options{Dirpath: dirpath, WorkerCount: dlWorkerCount}, ctx)
+}
+
+// Fetch fetches the deviations provided by sources as specified by options. Return
+// information on all fetched deviations.
+func Fetch(sources []Source, options Options, ctx Context) djson.DeviantFetch {
 	// Buffered channel so that fetching RSSs isn't completely blocked by
 	// downloaders.
-	rssItemChan := make(chan djson.RssItem, 500)
-	rssFinished := make(chan struct{})
-	go fetchRss(rssItemChan, rssFinished, ctx)
+	jobChan := make(chan fetchJob, 500)
+	resultChan := make(chan fetchResult)
+	go fetchItems(sources, options, jobChan, resultChan, ctx)
 
+	var store *blobStore
+	if options.ContentAddressed {
+		store = newBlobStore(options.Dirpath)
+	}
 	dlWaitGroup := sync.WaitGroup{}
 	savedDeviationChan := make(chan djson.SavedDeviation)
-	for i := 0; i < dlWorkerCount; i++ {
+	for i := 0; i < options.WorkerCount; i++ {
 		dlWaitGroup.Add(1)
 		go saveDeviations(
 			i,
-			dirpath,
-			rssItemChan,
+			options,
+			jobChan,
 			savedDeviationChan,
 			&dlWaitGroup,
 			false,
+			store,
 			ctx)
 	}
 
@@ -358,18 +813,58 @@ func FetchFavorites(dirpath string, dlWorkerCount int, ctx Context) djson.Devian
 	go collectSavedDeviations(savedDeviationChan, deviantFetchChan)
 
 	// Wait until RSS downloads have finished
-	<-rssFinished
-	shared.Logger.Info("Go routine for fetching RSS files has finished.")
-	// Close RSS channel in order to signal to downloaders that there's no more
+	result := <-resultChan
+	shared.Logger.Info("Go routine for fetching items has finished.")
+	// Close job channel in order to signal to downloaders that there's no more
 	// jobs coming.
-	close(rssItemChan)
+	close(jobChan)
 	// Wait for the downloaders to finish
 	dlWaitGroup.Wait()
 	shared.Logger.Info("All downloaders have finished.")
 	// Downloaders finished so close chan so that collector stops waiting
 	close(savedDeviationChan)
 	// And finally get information on all favorite deviations from collector
-	return <-deviantFetchChan
+	deviantFetch := <-deviantFetchChan
+	// Only now all sources have been read so it's known where each deviation
+	// was found.
+	for i := range deviantFetch.SavedDeviations {
+		each := &deviantFetch.SavedDeviations[i]
+		each.Origins = result.origins[deviationKey(each.RssItem)]
+		each.FavoritedBy = deriveFavoritedBy(each.Origins)
+		each.Positions = result.positions[deviationKey(each.RssItem)]
+		each.FirstSeen = deviantFetch.Timestamp
+		each.LastSeen = deviantFetch.Timestamp
+	}
+	for i := range result.skipped {
+		each := &result.skipped[i]
+		each.Origins = result.origins[deviationKey(each.RssItem)]
+	}
+	deviantFetch.Listings = result.listings
+	deviantFetch.Skipped = result.skipped
+	merged := mergeFetch(options.Previous, deviantFetch, result)
+	// Workers finish in any order, the manifest is sorted so that it's stable between fetches.
+	sortByPosition(merged.SavedDeviations, merged.Listings, result.positions)
+	if options.Previous != nil {
+		markRemoved(merged, result.origins, ctx)
+	}
+	saveAuthorAvatars(options.Dirpath, merged.SavedDeviations, ctx)
+	return merged
+}
+
+// LoadJSON loads information on fetched deviations from file filename.
+func LoadJSON(filename string) (djson.DeviantFetch, error) {
+	jsonBytes, err := os.ReadFile(filename)
+	if err != nil {
+		shared.Logger.Error("Error reading JSON.", "filename", filename, "error", err)
+		return djson.DeviantFetch{}, err
+	}
+
+	var deviantFetch djson.DeviantFetch
+	if err := json.Unmarshal(jsonBytes, &deviantFetch); err != nil {
+		shared.Logger.Error("Conversion from json failed.", "filename", filename, "error", err)
+		return djson.DeviantFetch{}, err
+	}
+	return deviantFetch, nil
 }
 
 // SaveJSON saves information on fetched deviations to file filename.
@@ -2,7 +2,9 @@ package dafavorites
 
 import (
 	"fmt"
+	"io"
 	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -38,12 +40,20 @@ func TestToRssFile(t *testing.T) {
 		GUID:            "https://art0fck.deviantart.com/art/Leya-671530106",
 		PublicationDate: "Tue, 28 Mar 2017 03:37:53 PDT",
 		Author:          "art0fCK",
+		AuthorURL:       "https://art0fck.deviantart.com",
+		AuthorAvatarURL: "https://a.deviantart.net/avatars/a/r/art0fck.jpg?2",
 		URL: "https://pre00.deviantart.net/04fc/th/pre/f/2017/087/" +
 			"d/3/d3cf26870151df8b05491ec8c1242fc8-db3t7y2.jpg",
 		Dimensions: djson.Dimensions{
 			Width:  730,
 			Height: 1095,
 		},
+		Rating:              "adult",
+		Category:            "photography/people/nude",
+		CategoryLabel:       "Artistic Nude",
+		Description:         "artofckphoto.com",
+		DescriptionMarkdown: "artofckphoto.com",
+		Medium:              MediumImage,
 	}
 	actualFirstItem := rssFile.rssItems[0]
 	req.Equal(expectedFirstItem, actualFirstItem, "Mismatched first RSS item.")
@@ -56,12 +66,27 @@ func TestToRssFile(t *testing.T) {
 			"double-fluo-64794797",
 		PublicationDate: "Thu, 13 Sep 2007 07:48:45 PDT",
 		Author:          "ABrito",
+		AuthorURL:       "https://abrito.deviantart.com",
+		AuthorAvatarURL: "https://a.deviantart.net/avatars/a/b/abrito.jpg?1",
 		URL: "https://orig00.deviantart.net/" +
 			"8878/f/2007/256/0/9/no_title_33_by_abrito.jpg",
 		Dimensions: djson.Dimensions{
 			Width:  554,
 			Height: 750,
 		},
+		Rating:        "adult",
+		Category:      "photography/people/nude",
+		CategoryLabel: "Artistic Nude",
+		Description: "Some experience with some fluo lighting...<br> Hope you like it !!<br> <br> " +
+			"Session with my friend Jose Manchado " +
+			`<a href="https://josemanchado.deviantart.com/">` +
+			`<img src="https://a.deviantart.com/avatars/j/o/josemanchado.png" ` +
+			`alt=":iconjosemanchado:"></a>`,
+		DescriptionMarkdown: "Some experience with some fluo lighting...\nHope you like it !!\n\n" +
+			"Session with my friend Jose Manchado " +
+			"[![:iconjosemanchado:](https://a.deviantart.com/avatars/j/o/josemanchado.png)]" +
+			"(https://josemanchado.deviantart.com/)",
+		Medium: MediumImage,
 	}
 	actualLastItem := rssFile.rssItems[len(rssFile.rssItems)-1]
 	req.Equal(expectedLastItem, actualLastItem, "Mismatched last RSS item.")
@@ -94,7 +119,7 @@ func TestFetchFavorites(t *testing.T) {
 	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
 	ctx := &TestContext{
 		fsys:       fsys,
-		username:   "denarced",
+		usernames:  []string{"denarced"},
 		httpClient: httpClient,
 	}
 
@@ -118,6 +143,7 @@ func TestFetchFavorites(t *testing.T) {
 					Width:  894,
 					Height: 894,
 				},
+				Medium: MediumImage,
 			},
 			{
 				Title:           "Kat",
@@ -130,28 +156,152 @@ func TestFetchFavorites(t *testing.T) {
 					Width:  730,
 					Height: 1095,
 				},
+				Medium: MediumImage,
 			},
 		},
 		[]djson.RssItem{deviations[0].RssItem, deviations[1].RssItem},
 	)
-	verifyFileContent(require.New(t), fsys, dirp, "anna.jpg", []byte("anna\n"))
-	verifyFileContent(require.New(t), fsys, dirp, "kat.jpg", []byte("kat\n"))
+	ass.Equal(
+		[]djson.Origin{{Kind: SourceFavorites, Username: "denarced"}},
+		deviations[0].Origins)
+	ass.Equal([]string{"denarced"}, deviations[0].FavoritedBy)
+	verifyFileContent(require.New(t), fsys, dirp, "anna.jpg", fixtureBytes(t, annaImageURL))
+	verifyFileContent(require.New(t), fsys, dirp, "kat.jpg", fixtureBytes(t, katImageURL))
 	ass.NotNil(fetched.Timestamp)
 	ass.Nil(httpClient.err)
 }
 
+func TestFetchFromSource(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	httpClient := newTestHTTPClient()
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: httpClient,
+	}
+	favorites := &testSource{
+		pages: [][]djson.RssItem{
+			{{Title: "Anna", URL: "https://images-wixmp.wixmp.com/anna.jpg"}},
+			{},
+		},
+		origin: djson.Origin{Kind: SourceFavorites, Username: "denarced"},
+	}
+	gallery := &testSource{
+		pages: [][]djson.RssItem{
+			{{Title: "Kat", URL: "https://images-wixmp.com/kat.jpg"}},
+		},
+		origin: djson.Origin{Kind: SourceGallery, Username: "denarced"},
+	}
+
+	// EXERCISE
+	fetched := Fetch([]Source{favorites, gallery}, Options{Dirpath: dirp, WorkerCount: 2}, ctx)
+
+	// VERIFY
+	ass := assert.New(t)
+	origins := map[string][]djson.Origin{}
+	for _, each := range fetched.SavedDeviations {
+		origins[each.RssItem.Title] = each.Origins
+	}
+	ass.Equal(
+		map[string][]djson.Origin{
+			"Anna": {favorites.origin},
+			"Kat":  {gallery.origin},
+		},
+		origins)
+	ass.Equal(3, favorites.calls, "Next should be called until io.EOF.")
+	ass.Equal(2, gallery.calls, "Next should be called until io.EOF.")
+	verifyFileContent(require.New(t), fsys, dirp, "anna.jpg", fixtureBytes(t, annaImageURL))
+	verifyFileContent(require.New(t), fsys, dirp, "kat.jpg", fixtureBytes(t, katImageURL))
+	ass.Nil(httpClient.err)
+}
+
+func TestFetchDeduplicates(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: newTestHTTPClient(),
+	}
+	kat := djson.RssItem{
+		Title: "Kat",
+		GUID:  "https://www.deviantart.com/friesellfly/art/Kat-1042398875",
+		URL:   "https://images-wixmp.com/kat.jpg",
+	}
+	newSource := func(kind, username string) *testSource {
+		return &testSource{
+			pages:  [][]djson.RssItem{{kat}},
+			origin: djson.Origin{Kind: kind, Username: username},
+		}
+	}
+	sources := []Source{
+		newSource(SourceFavorites, "zed"),
+		newSource(SourceFavorites, "adam"),
+		newSource(SourceGallery, "friesellfly"),
+	}
+
+	// EXERCISE
+	fetched := Fetch(sources, Options{Dirpath: dirp, WorkerCount: 2}, ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Equal(1, len(fetched.SavedDeviations))
+	deviation := fetched.SavedDeviations[0]
+	req.ElementsMatch(
+		[]djson.Origin{
+			{Kind: SourceFavorites, Username: "zed"},
+			{Kind: SourceFavorites, Username: "adam"},
+			{Kind: SourceGallery, Username: "friesellfly"},
+		},
+		deviation.Origins)
+	req.Equal([]string{"adam", "zed"}, deviation.FavoritedBy)
+	files, err := fsys.ReadDir(dirp)
+	req.Nil(err)
+	req.Equal(1, len(files), "Deviation should be downloaded only once.")
+}
+
+const (
+	annaImageURL = "https://images-wixmp.wixmp.com/anna.jpg"
+	katImageURL  = "https://images-wixmp.com/kat.jpg"
+)
+
+type testSource struct {
+	pages  [][]djson.RssItem
+	calls  int
+	origin djson.Origin
+}
+
+func (v *testSource) Next(Context) ([]djson.RssItem, error) {
+	v.calls++
+	if len(v.pages) == 0 {
+		return nil, io.EOF
+	}
+	page := v.pages[0]
+	v.pages = v.pages[1:]
+	return page, nil
+}
+
+func (v *testSource) Origin() djson.Origin {
+	return v.origin
+}
+
+func (v *testSource) hasNext() bool {
+	return len(v.pages) > 0
+}
+
 type TestContext struct {
 	fsys       *afero.Afero
 	httpClient *TestHTTPClient
-	username   string
+	usernames  []string
 }
 
 func (v *TestContext) Fsys() *afero.Afero {
 	return v.fsys
 }
 
-func (v *TestContext) Username() string {
-	return v.username
+func (v *TestContext) Usernames() []string {
+	return v.usernames
 }
 
 func (v *TestContext) CreateClient() HTTPClient {
@@ -160,6 +310,8 @@ func (v *TestContext) CreateClient() HTTPClient {
 
 type TestHTTPClient struct {
 	err error
+	// Header Content-Type by URL, empty by default.
+	contentTypes map[string]string
 }
 
 func newTestHTTPClient() *TestHTTPClient {
@@ -167,14 +319,30 @@ func newTestHTTPClient() *TestHTTPClient {
 }
 
 func (v *TestHTTPClient) Fetch(url string) ([]byte, error) {
-	filep := filepath.Join("testdata", "TestFetchFavorites", strings.ReplaceAll(url, "/", "_"))
-	bytes, err := readFile(filep)
+	bytes, err := readFile(deriveFixturePath(url))
 	if v.err == nil && err != nil {
 		v.err = err
 	}
 	return bytes, err
 }
 
+func (v *TestHTTPClient) Download(url string) (Response, error) {
+	bytes, err := v.Fetch(url)
+	if err != nil {
+		return Response{StatusCode: http.StatusNotFound, ContentLength: -1}, nil
+	}
+	return Response{
+		Body:          bytes,
+		StatusCode:    http.StatusOK,
+		ContentType:   v.contentTypes[url],
+		ContentLength: int64(len(bytes)),
+	}, nil
+}
+
+func deriveFixturePath(url string) string {
+	return filepath.Join("testdata", "TestFetchFavorites", strings.ReplaceAll(url, "/", "_"))
+}
+
 func readFile(filep string) ([]byte, error) {
 	file, err := os.Open(filep)
 	if err != nil {
@@ -230,3 +398,36 @@ func verifyFileContent(
 	req.Nil(err, "read-file-err")
 	req.Equal(expected, bytes)
 }
+
+// Read the fixture that TestHTTPClient serves for url.
+func fixtureBytes(t *testing.T, url string) []byte {
+	bytes, err := readFile(deriveFixturePath(url))
+	require.Nil(t, err)
+	return bytes
+}
+
+// Create an image item with guid as its GUID and title.
+func createRssItem(guid, url string) djson.RssItem {
+	return djson.RssItem{GUID: guid, Title: guid, URL: url, Medium: MediumImage}
+}
+
+// Create a deviation of an image in url that was saved as filename, which is also its GUID, with
+// content. Without content the deviation has no checksum.
+func createSavedDeviation(filename, url string, content []byte) djson.SavedDeviation {
+	deviation := djson.SavedDeviation{RssItem: createRssItem(filename, url), Filename: filename}
+	if content != nil {
+		deviation.Size = int64(len(content))
+		deviation.SHA256 = sha256Hex(string(content))
+	}
+	return deviation
+}
+
+// Write content into file filename in directory dirpath.
+func writeArchiveFile(
+	req *require.Assertions,
+	fsys *afero.Afero,
+	dirpath, filename string,
+	content []byte,
+) {
+	req.Nil(fsys.WriteFile(filepath.Join(dirpath, filename), content, 0600))
+}
@@ -0,0 +1,302 @@
+package dafavorites
+
+import (
+	"bytes"
+	"encoding/xml"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/denarced/dafavorites/shared/shared"
+)
+
+var (
+	// A "<" that doesn't start a tag, e.g. in "a < b".
+	strayLessThanPattern = regexp.MustCompile(`<([^a-zA-Z/!?]|$)`)
+	// Whitespace, including non-breaking spaces, that's collapsed into a single space.
+	whitespacePattern = regexp.MustCompile(`[\s\x{a0}]+`)
+	// Characters that have a special meaning in Markdown.
+	markdownEscaper = strings.NewReplacer(
+		`\`, `\\`,
+		"`", "\\`",
+		"*", `\*`,
+		"_", `\_`,
+		"[", `\[`,
+		"]", `\]`)
+	// Characters that would end a link target in Markdown.
+	markdownURLEscaper = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29")
+)
+
+// Elements that are kept in the cleaned HTML, each with the Markdown written for its start and
+// end. All other elements are dropped but their text is kept.
+var descriptionElements = map[string][2]string{
+	"a":          {"[", ""},
+	"b":          {"**", "**"},
+	"strong":     {"**", "**"},
+	"i":          {"_", "_"},
+	"em":         {"_", "_"},
+	"u":          {"", ""},
+	"s":          {"~~", "~~"},
+	"strike":     {"~~", "~~"},
+	"sub":        {"", ""},
+	"sup":        {"", ""},
+	"code":       {"`", "`"},
+	"p":          {"\n\n", "\n\n"},
+	"div":        {"\n\n", "\n\n"},
+	"blockquote": {"\n\n> ", "\n\n"},
+	"pre":        {"\n\n", "\n\n"},
+	"ul":         {"\n\n", "\n\n"},
+	"ol":         {"\n\n", "\n\n"},
+	"li":         {"\n- ", ""},
+	"h1":         {"\n\n# ", "\n\n"},
+	"h2":         {"\n\n## ", "\n\n"},
+	"h3":         {"\n\n### ", "\n\n"},
+	"h4":         {"\n\n#### ", "\n\n"},
+	"h5":         {"\n\n##### ", "\n\n"},
+	"h6":         {"\n\n###### ", "\n\n"},
+}
+
+// Elements whose content is dropped altogether.
+var droppedElements = map[string]bool{
+	"script": true,
+	"style":  true,
+	"iframe": true,
+	"object": true,
+}
+
+// CleanDescription converts a deviation's description, which is HTML, to cleaned HTML and to
+// Markdown. Only simple formatting, links and images are kept in the HTML. Deviant Art's
+// "users/outgoing" redirects are unwrapped to the real link targets and emoticons are converted
+// to their text, e.g. ":)". Broken HTML is cleaned as far as it can be read.
+func CleanDescription(description string) (string, string) {
+	if strings.TrimSpace(description) == "" {
+		return "", ""
+	}
+	cleaner := descriptionCleaner{}
+	cleaner.clean(description)
+	return strings.TrimSpace(cleaner.html.String()), cleaner.deriveMarkdown()
+}
+
+type descriptionCleaner struct {
+	html     strings.Builder
+	markdown strings.Builder
+	// Open elements that are kept, innermost last.
+	open []string
+	// The link target of each open <a>, innermost last. Empty for links that were dropped.
+	links []string
+	// How deep inside dropped elements, e.g. <script>, the decoder is.
+	dropDepth int
+}
+
+func (v *descriptionCleaner) clean(description string) {
+	escaped := strayLessThanPattern.ReplaceAllString(description, "&lt;$1")
+	decoder := xml.NewDecoder(strings.NewReader(escaped))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	for {
+		// Raw tokens because HTML end tags don't necessarily match the start tags.
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			shared.Logger.Warn("Failed to read description, truncating it.", "error", err)
+			break
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			v.start(element)
+		case xml.EndElement:
+			v.end(strings.ToLower(element.Name.Local))
+		case xml.CharData:
+			v.text(string(element))
+		}
+	}
+	for len(v.open) > 0 {
+		v.end(v.open[len(v.open)-1])
+	}
+}
+
+func (v *descriptionCleaner) start(element xml.StartElement) {
+	name := strings.ToLower(element.Name.Local)
+	if droppedElements[name] {
+		v.dropDepth++
+		return
+	}
+	if v.dropDepth > 0 {
+		return
+	}
+	attributes := map[string]string{}
+	for _, each := range element.Attr {
+		attributes[strings.ToLower(each.Name.Local)] = strings.TrimSpace(each.Value)
+	}
+	switch name {
+	case "br":
+		v.html.WriteString("<br>")
+		v.markdown.WriteString("\n")
+		return
+	case "img":
+		v.image(attributes)
+		return
+	}
+	markdown, kept := descriptionElements[name]
+	if !kept {
+		return
+	}
+	if name == "a" {
+		href := unwrapOutgoingLink(attributes["href"])
+		v.links = append(v.links, href)
+		if href == "" {
+			v.open = append(v.open, name)
+			return
+		}
+		v.html.WriteString(`<a href="` + html.EscapeString(href) + `">`)
+		v.markdown.WriteString(markdown[0])
+		v.open = append(v.open, name)
+		return
+	}
+	// Like in HTML, e.g. <li> closes the previous <li> in the same list.
+	switch name {
+	case "li":
+		v.closeImplicitly(name, "ul", "ol")
+	case "p":
+		v.closeImplicitly(name, "div", "blockquote", "li")
+	}
+	v.html.WriteString("<" + name + ">")
+	v.markdown.WriteString(markdown[0])
+	v.open = append(v.open, name)
+}
+
+// Close element name if it's open and none of containers has been opened inside it.
+func (v *descriptionCleaner) closeImplicitly(name string, containers ...string) {
+	for i := len(v.open) - 1; i >= 0; i-- {
+		if v.open[i] == name {
+			v.end(name)
+			return
+		}
+		if slices.Contains(containers, v.open[i]) {
+			return
+		}
+	}
+}
+
+// Close element name and any elements opened after it. End tags of elements that aren't open are
+// ignored.
+func (v *descriptionCleaner) end(name string) {
+	if droppedElements[name] {
+		if v.dropDepth > 0 {
+			v.dropDepth--
+		}
+		return
+	}
+	index := -1
+	for i := len(v.open) - 1; i >= 0; i-- {
+		if v.open[i] == name {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return
+	}
+	for len(v.open) > index {
+		closed := v.open[len(v.open)-1]
+		v.open = v.open[:len(v.open)-1]
+		if closed != "a" {
+			v.html.WriteString("</" + closed + ">")
+			v.markdown.WriteString(descriptionElements[closed][1])
+			continue
+		}
+		href := v.links[len(v.links)-1]
+		v.links = v.links[:len(v.links)-1]
+		if href != "" {
+			v.html.WriteString("</a>")
+			v.markdown.WriteString("](" + markdownURLEscaper.Replace(href) + ")")
+		}
+	}
+}
+
+func (v *descriptionCleaner) text(text string) {
+	if v.dropDepth > 0 {
+		return
+	}
+	collapsed := whitespacePattern.ReplaceAllString(text, " ")
+	v.html.WriteString(html.EscapeString(collapsed))
+	v.markdown.WriteString(markdownEscaper.Replace(collapsed))
+}
+
+// Write an image, or its text if the image is an emoticon.
+func (v *descriptionCleaner) image(attributes map[string]string) {
+	src, alt := attributes["src"], attributes["alt"]
+	if attributes["data-embed-type"] == "emoticon" || strings.Contains(src, "/emoticons/") {
+		v.html.WriteString(html.EscapeString(alt))
+		v.markdown.WriteString(markdownEscaper.Replace(alt))
+		return
+	}
+	if !isSafeLink(src) {
+		return
+	}
+	v.html.WriteString(
+		`<img src="` + html.EscapeString(src) + `" alt="` + html.EscapeString(alt) + `">`)
+	v.markdown.WriteString(
+		"![" + markdownEscaper.Replace(alt) + "](" + markdownURLEscaper.Replace(src) + ")")
+}
+
+// Trim the whitespace around line breaks in Markdown and collapse empty lines into one.
+func (v *descriptionCleaner) deriveMarkdown() string {
+	lines := strings.Split(v.markdown.String(), "\n")
+	var result bytes.Buffer
+	empty := 0
+	for _, each := range lines {
+		line := strings.TrimSpace(each)
+		if line == "" {
+			empty++
+			continue
+		}
+		if result.Len() > 0 {
+			result.WriteString("\n")
+			if empty > 0 {
+				result.WriteString("\n")
+			}
+		}
+		empty = 0
+		result.WriteString(line)
+	}
+	return result.String()
+}
+
+// Unwrap Deviant Art's redirect, e.g.
+// "http://www.deviantart.com/users/outgoing?http://www.likmeetup.com/", to the real link target.
+// Empty is returned for links that aren't safe to follow, e.g. "javascript:".
+func unwrapOutgoingLink(href string) string {
+	parsed, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(parsed.Hostname())
+	isDeviantArt := host == "deviantart.com" || strings.HasSuffix(host, ".deviantart.com")
+	if isDeviantArt && strings.TrimSuffix(parsed.Path, "/") == "/users/outgoing" {
+		target := parsed.RawQuery
+		// The target is sometimes escaped, e.g. "http%3A%2F%2Fexample.com".
+		if !strings.Contains(target, "://") {
+			if unescaped, err := url.QueryUnescape(target); err == nil {
+				target = unescaped
+			}
+		}
+		href = target
+	}
+	if !isSafeLink(href) {
+		return ""
+	}
+	return href
+}
+
+func isSafeLink(href string) bool {
+	lower := strings.ToLower(href)
+	return strings.HasPrefix(lower, "http://") ||
+		strings.HasPrefix(lower, "https://") ||
+		strings.HasPrefix(lower, "mailto:")
+}
@@ -0,0 +1,60 @@
+package dafavorites
+
+import (
+	"testing"
+
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanDescription(t *testing.T) {
+	run := func(name, description, expectedHTML, expectedMarkdown string) {
+		t.Run(name, func(t *testing.T) {
+			shared.InitTestLogging(t)
+			actualHTML, actualMarkdown := CleanDescription(description)
+			req := require.New(t)
+			req.Equal(expectedHTML, actualHTML, "HTML")
+			req.Equal(expectedMarkdown, actualMarkdown, "Markdown")
+		})
+	}
+
+	run("empty", " ", "", "")
+	run("plain", "Just text", "Just text", "Just text")
+	run(
+		"deviant art",
+		`Image done for the workshop in Taipei that's going to happen next week:&nbsp;`+
+			`<a class="external" href="http://www.deviantart.com/users/outgoing?`+
+			`http://www.likmeetup.com/">www.likmeetup.com/</a><br /><br />`+
+			`Struggled with it a lot myself, but I'm letting it go, haha `+
+			`<img src="http://e.deviantart.net/emoticons/s/smile.gif" width="15" height="15" `+
+			`alt=":)" data-embed-type="emoticon" data-embed-id="391" title=":) (Smile)"/>`+
+			` Hope you like it! Love you guys!`,
+		"Image done for the workshop in Taipei that&#39;s going to happen next week: "+
+			`<a href="http://www.likmeetup.com/">www.likmeetup.com/</a><br><br>`+
+			"Struggled with it a lot myself, but I&#39;m letting it go, haha :) "+
+			"Hope you like it! Love you guys!",
+		"Image done for the workshop in Taipei that's going to happen next week: "+
+			"[www.likmeetup.com/](http://www.likmeetup.com/)\n\n"+
+			"Struggled with it a lot myself, but I'm letting it go, haha :) "+
+			"Hope you like it! Love you guys!")
+	run(
+		"escaped outgoing",
+		`<a href="https://www.deviantart.com/users/outgoing?https%3A%2F%2Fexample.com%2Fa">a</a>`,
+		`<a href="https://example.com/a">a</a>`,
+		"[a](https://example.com/a)")
+	run(
+		"unsafe link",
+		`<a href="javascript:alert(1)">click</a>`,
+		"click",
+		"click")
+	run(
+		"formatting",
+		"<p>A <b>bold</b> and <i>_italic_</i> text</p><ul><li>one<li>two</ul>",
+		"<p>A <b>bold</b> and <i>_italic_</i> text</p><ul><li>one</li><li>two</li></ul>",
+		"A **bold** and _\\_italic\\__ text\n\n- one\n- two")
+	run(
+		"broken",
+		`a < b <span style="color: red">c</b> <script>alert(1)</script>d</span>`,
+		"a &lt; b c d",
+		"a < b c d")
+}
@@ -0,0 +1,310 @@
+package dafavorites
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+)
+
+const (
+	// DiffFormatText is plain text for the terminal.
+	DiffFormatText = "text"
+	// DiffFormatJSON is the ManifestDiff itself as JSON.
+	DiffFormatJSON = "json"
+	// DiffFormatMarkdown is Markdown, e.g. for posting to chat.
+	DiffFormatMarkdown = "markdown"
+)
+
+// Longest value shown of a changed field in text and Markdown, in characters.
+const maxDiffValueLength = 80
+
+// Fields that change in every fetch and would bury the interesting changes.
+var ignoredDiffFields = []string{"LastSeen", "Positions"}
+
+// ManifestDiff is how two manifests differ. Deviations are matched by their GUIDs or, for
+// deviations without one, by their links or image URLs.
+type ManifestDiff struct {
+	// The timestamps of the old and the new manifest.
+	From time.Time
+	To   time.Time
+	// Deviations only in the new manifest, in its order.
+	Added []DiffDeviation
+	// Deviations only in the old manifest, in its order.
+	Removed []DiffDeviation
+	// Deviations in both whose fields differ, in the new manifest's order.
+	Changed []DiffDeviation
+}
+
+// Empty tells whether the manifests have the same deviations with the same fields.
+func (v ManifestDiff) Empty() bool {
+	return len(v.Added) == 0 && len(v.Removed) == 0 && len(v.Changed) == 0
+}
+
+// DiffDeviation is a single deviation that differs between manifests.
+type DiffDeviation struct {
+	Title    string
+	Author   string
+	Link     string
+	Filename string
+	// The fields that differ, sorted by field. Empty for added and removed deviations.
+	Changes []FieldChange
+}
+
+// FieldChange is a single field of a deviation that differs between manifests.
+type FieldChange struct {
+	// The field's path in the manifest, e.g. "RssItem.Title".
+	Field string
+	Old   string
+	New   string
+}
+
+// DiffManifests compares manifest older with manifest newer. Fields LastSeen and Positions are
+// ignored because they change in every fetch.
+func DiffManifests(older, newer djson.DeviantFetch) (ManifestDiff, error) {
+	diff := ManifestDiff{From: older.Timestamp, To: newer.Timestamp}
+	olderByKey := map[string]djson.SavedDeviation{}
+	for _, each := range older.SavedDeviations {
+		olderByKey[deviationKey(each.RssItem)] = each
+	}
+	newerKeys := map[string]bool{}
+	for _, each := range newer.SavedDeviations {
+		key := deviationKey(each.RssItem)
+		newerKeys[key] = true
+		previous, found := olderByKey[key]
+		if !found {
+			diff.Added = append(diff.Added, newDiffDeviation(each))
+			continue
+		}
+		changes, err := diffDeviations(previous, each)
+		if err != nil {
+			shared.Logger.Error("Failed to compare deviations.", "key", key, "error", err)
+			return ManifestDiff{}, err
+		}
+		if len(changes) > 0 {
+			changed := newDiffDeviation(each)
+			changed.Changes = changes
+			diff.Changed = append(diff.Changed, changed)
+		}
+	}
+	for _, each := range older.SavedDeviations {
+		if !newerKeys[deviationKey(each.RssItem)] {
+			diff.Removed = append(diff.Removed, newDiffDeviation(each))
+		}
+	}
+	return diff, nil
+}
+
+func newDiffDeviation(deviation djson.SavedDeviation) DiffDeviation {
+	return DiffDeviation{
+		Title:    deviation.RssItem.Title,
+		Author:   deviation.RssItem.Author,
+		Link:     deviation.RssItem.Link,
+		Filename: deviation.Filename,
+	}
+}
+
+// Compare the fields of two versions of a deviation.
+func diffDeviations(older, newer djson.SavedDeviation) ([]FieldChange, error) {
+	olderFields, err := flattenDeviation(older)
+	if err != nil {
+		return nil, err
+	}
+	newerFields, err := flattenDeviation(newer)
+	if err != nil {
+		return nil, err
+	}
+	var changes []FieldChange
+	for field, value := range newerFields {
+		if olderFields[field] != value {
+			changes = append(
+				changes,
+				FieldChange{Field: field, Old: olderFields[field], New: value})
+		}
+	}
+	for field, value := range olderFields {
+		if _, found := newerFields[field]; !found && value != "" {
+			changes = append(changes, FieldChange{Field: field, Old: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes, nil
+}
+
+// Flatten deviation into its fields as they're in the manifest, e.g. "RssItem.Title" -> "Kat".
+// Lists are kept whole as JSON. Missing, null and empty values are all empty.
+func flattenDeviation(deviation djson.SavedDeviation) (map[string]string, error) {
+	encoded, err := json.Marshal(deviation)
+	if err != nil {
+		return nil, err
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, err
+	}
+	fields := map[string]string{}
+	for _, each := range ignoredDiffFields {
+		delete(decoded, each)
+	}
+	flattenValue("", decoded, fields)
+	return fields, nil
+}
+
+func flattenValue(path string, value any, fields map[string]string) {
+	switch typed := value.(type) {
+	case map[string]any:
+		for key, each := range typed {
+			if path != "" {
+				key = path + "." + key
+			}
+			flattenValue(key, each, fields)
+		}
+	case nil:
+		fields[path] = ""
+	case string:
+		fields[path] = typed
+	case []any:
+		if len(typed) == 0 {
+			fields[path] = ""
+			return
+		}
+		encoded, _ := json.Marshal(typed)
+		fields[path] = string(encoded)
+	default:
+		encoded, _ := json.Marshal(typed)
+		fields[path] = string(encoded)
+	}
+}
+
+// WriteDiff writes diff to writer in format: DiffFormatText, DiffFormatJSON or
+// DiffFormatMarkdown. Long values are shortened in text and Markdown.
+func WriteDiff(writer io.Writer, diff ManifestDiff, format string) error {
+	var content string
+	switch format {
+	case DiffFormatText:
+		content = formatDiffText(diff)
+	case DiffFormatMarkdown:
+		content = formatDiffMarkdown(diff)
+	case DiffFormatJSON:
+		encoded, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return err
+		}
+		content = string(encoded) + "\n"
+	default:
+		return fmt.Errorf("unknown diff format %q", format)
+	}
+	_, err := io.WriteString(writer, content)
+	return err
+}
+
+func formatDiffText(diff ManifestDiff) string {
+	if diff.Empty() {
+		return "No differences.\n"
+	}
+	var builder strings.Builder
+	describe := func(each DiffDeviation) string {
+		description := each.Title
+		if each.Author != "" {
+			description += " by " + each.Author
+		}
+		if each.Link != "" {
+			return description + ": " + each.Link
+		}
+		return description + ": " + each.Filename
+	}
+	for _, group := range []struct {
+		name       string
+		marker     string
+		deviations []DiffDeviation
+	}{
+		{"Added", "+", diff.Added},
+		{"Removed", "-", diff.Removed},
+		{"Changed", "~", diff.Changed},
+	} {
+		if len(group.deviations) == 0 {
+			continue
+		}
+		fmt.Fprintf(&builder, "%s (%d):\n", group.name, len(group.deviations))
+		for _, each := range group.deviations {
+			fmt.Fprintf(&builder, "  %s %s\n", group.marker, describe(each))
+			for _, change := range each.Changes {
+				fmt.Fprintf(
+					&builder,
+					"      %s: %q -> %q\n",
+					change.Field,
+					shortenDiffValue(change.Old),
+					shortenDiffValue(change.New))
+			}
+		}
+	}
+	return builder.String()
+}
+
+func formatDiffMarkdown(diff ManifestDiff) string {
+	if diff.Empty() {
+		return "No differences.\n"
+	}
+	var builder strings.Builder
+	describe := func(each DiffDeviation) string {
+		title := markdownEscaper.Replace(each.Title)
+		if each.Link != "" {
+			title = "[" + title + "](" + markdownURLEscaper.Replace(each.Link) + ")"
+		}
+		if each.Author == "" {
+			return title
+		}
+		return title + " by " + markdownEscaper.Replace(each.Author)
+	}
+	code := func(value string) string {
+		if value == "" {
+			return "_empty_"
+		}
+		// Backticks can't be escaped inside code spans.
+		return "`" + strings.ReplaceAll(shortenDiffValue(value), "`", "'") + "`"
+	}
+	for _, group := range []struct {
+		name       string
+		deviations []DiffDeviation
+	}{
+		{"Added", diff.Added},
+		{"Removed", diff.Removed},
+		{"Changed", diff.Changed},
+	} {
+		if len(group.deviations) == 0 {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteString("\n")
+		}
+		fmt.Fprintf(&builder, "## %s (%d)\n\n", group.name, len(group.deviations))
+		for _, each := range group.deviations {
+			fmt.Fprintf(&builder, "- %s\n", describe(each))
+			for _, change := range each.Changes {
+				fmt.Fprintf(
+					&builder,
+					"  - %s: %s → %s\n",
+					code(change.Field),
+					code(change.Old),
+					code(change.New))
+			}
+		}
+	}
+	return builder.String()
+}
+
+// Shorten value to maxDiffValueLength characters, with line breaks collapsed.
+func shortenDiffValue(value string) string {
+	runes := []rune(strings.Join(strings.Fields(value), " "))
+	if len(runes) <= maxDiffValueLength {
+		return string(runes)
+	}
+	return string(runes[:maxDiffValueLength-1]) + "…"
+}
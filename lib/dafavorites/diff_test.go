@@ -0,0 +1,170 @@
+package dafavorites
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create manifests that differ in each way: added, removed and changed.
+func createDiffManifests() (djson.DeviantFetch, djson.DeviantFetch) {
+	var deviations []djson.SavedDeviation
+	for i, title := range []string{"Same", "Kat", "Gone", "New"} {
+		guid := fmt.Sprintf("https://example.com/%d", i+1)
+		deviations = append(
+			deviations,
+			djson.SavedDeviation{
+				RssItem:  djson.RssItem{GUID: guid, Link: guid, Title: title, Author: "Painter"},
+				Filename: title + ".jpg",
+			})
+	}
+	unchanged, changed, gone, added := deviations[0], deviations[1], deviations[2], deviations[3]
+	changed.Size = 10
+	renamed := changed
+	renamed.RssItem.Title = "Kat II"
+	renamed.Size = 12
+	renamed.FavoritedBy = []string{"david"}
+	// Changes in every fetch, not worth a mention.
+	renamed.LastSeen = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	renamed.Positions = []djson.Position{{Page: 1, Position: 2}}
+	older := djson.DeviantFetch{
+		SavedDeviations: []djson.SavedDeviation{unchanged, changed, gone},
+		Timestamp:       time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+	}
+	newer := djson.DeviantFetch{
+		SavedDeviations: []djson.SavedDeviation{added, unchanged, renamed},
+		Timestamp:       time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+	return older, newer
+}
+
+func TestDiffManifests(t *testing.T) {
+	shared.InitTestLogging(t)
+	older, newer := createDiffManifests()
+
+	// EXERCISE
+	diff, err := DiffManifests(older, newer)
+
+	// VERIFY
+	req := require.New(t)
+	req.Nil(err)
+	req.Equal(
+		ManifestDiff{
+			From: older.Timestamp,
+			To:   newer.Timestamp,
+			Added: []DiffDeviation{{
+				Title:    "New",
+				Author:   "Painter",
+				Link:     "https://example.com/4",
+				Filename: "New.jpg",
+			}},
+			Removed: []DiffDeviation{{
+				Title:    "Gone",
+				Author:   "Painter",
+				Link:     "https://example.com/3",
+				Filename: "Gone.jpg",
+			}},
+			Changed: []DiffDeviation{{
+				Title:    "Kat II",
+				Author:   "Painter",
+				Link:     "https://example.com/2",
+				Filename: "Kat.jpg",
+				Changes: []FieldChange{
+					{Field: "FavoritedBy", New: `["david"]`},
+					{Field: "RssItem.Title", Old: "Kat", New: "Kat II"},
+					{Field: "Size", Old: "10", New: "12"},
+				},
+			}},
+		},
+		diff)
+	req.False(diff.Empty())
+
+	// EXERCISE
+	same, err := DiffManifests(older, older)
+
+	// VERIFY
+	req.Nil(err)
+	req.True(same.Empty())
+}
+
+func TestWriteDiff(t *testing.T) {
+	shared.InitTestLogging(t)
+	older, newer := createDiffManifests()
+	diff, err := DiffManifests(older, newer)
+	require.Nil(t, err)
+	run := func(format, expected string) {
+		t.Run(format, func(t *testing.T) {
+			var builder strings.Builder
+
+			// EXERCISE
+			err := WriteDiff(&builder, diff, format)
+
+			// VERIFY
+			req := require.New(t)
+			req.Nil(err)
+			req.Equal(expected, builder.String())
+		})
+	}
+
+	run(DiffFormatText, `Added (1):
+  + New by Painter: https://example.com/4
+Removed (1):
+  - Gone by Painter: https://example.com/3
+Changed (1):
+  ~ Kat II by Painter: https://example.com/2
+      FavoritedBy: "" -> "[\"david\"]"
+      RssItem.Title: "Kat" -> "Kat II"
+      Size: "10" -> "12"
+`)
+	run(DiffFormatMarkdown, "## Added (1)\n"+
+		"\n"+
+		"- [New](https://example.com/4) by Painter\n"+
+		"\n"+
+		"## Removed (1)\n"+
+		"\n"+
+		"- [Gone](https://example.com/3) by Painter\n"+
+		"\n"+
+		"## Changed (1)\n"+
+		"\n"+
+		"- [Kat II](https://example.com/2) by Painter\n"+
+		"  - `FavoritedBy`: _empty_ → `[\"david\"]`\n"+
+		"  - `RssItem.Title`: `Kat` → `Kat II`\n"+
+		"  - `Size`: `10` → `12`\n")
+
+	t.Run(DiffFormatJSON, func(t *testing.T) {
+		var builder strings.Builder
+
+		// EXERCISE
+		err := WriteDiff(&builder, diff, DiffFormatJSON)
+
+		// VERIFY
+		req := require.New(t)
+		req.Nil(err)
+		var decoded ManifestDiff
+		req.Nil(json.Unmarshal([]byte(builder.String()), &decoded))
+		req.Equal(diff, decoded)
+	})
+}
+
+func TestWriteDiffEmptyAndUnknownFormat(t *testing.T) {
+	ass := assert.New(t)
+	var builder strings.Builder
+	ass.Nil(WriteDiff(&builder, ManifestDiff{}, DiffFormatText))
+	ass.Equal("No differences.\n", builder.String())
+	ass.NotNil(WriteDiff(&builder, ManifestDiff{}, "html"))
+}
+
+func TestShortenDiffValue(t *testing.T) {
+	ass := assert.New(t)
+	ass.Equal("a b", shortenDiffValue("a\n  b"))
+	shortened := shortenDiffValue(strings.Repeat("å", 100))
+	ass.Equal(maxDiffValueLength, len([]rune(shortened)))
+	ass.True(strings.HasSuffix(shortened, "…"))
+}
@@ -0,0 +1,118 @@
+package dafavorites
+
+import (
+	"bytes"
+	"encoding/xml"
+	"time"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	dxml "github.com/denarced/dafavorites/lib/dafavorites/xml"
+)
+
+// SourceFeed is the origin kind of deviations from a generic Media RSS or Atom feed.
+const SourceFeed = "feed"
+
+// NewFeedSource creates a Source for any Media RSS or Atom feed in feedURL. Media is taken from
+// <media:content>, <enclosure> or Atom's <link rel="enclosure">. Pages are followed with
+// <atom:link rel="next"> in RSS and <link rel="next"> in Atom (RFC 5005). Atom's
+// <link rel="license"> is taken as the license.
+func NewFeedSource(feedURL string) Source {
+	return newPagedSource(feedURL, djson.Origin{Kind: SourceFeed, FeedURL: feedURL}, toFeedFile)
+}
+
+// Convert either RSS or Atom to an rssFile.
+func toFeedFile(contentBytes []byte) (rssFile, error) {
+	if !bytes.HasPrefix(rootPattern.Find(contentBytes), []byte("<feed")) {
+		return toRssFile(contentBytes)
+	}
+	feedElement, err := decodeAtom(contentBytes)
+	if err != nil {
+		return rssFile{}, err
+	}
+	return rssFile{
+		nextURL:  extractNextHref(feedElement.Links),
+		rssItems: entryElementsToItems(feedElement.Entries),
+	}, nil
+}
+
+// Decode Atom leniently like RSS in decodeRss.
+func decodeAtom(contentBytes []byte) (dxml.AtomFeedElement, error) {
+	feedElement := dxml.AtomFeedElement{}
+	decodeEntry := func(decoder *xml.Decoder) error {
+		wrapper := struct {
+			Entries []dxml.AtomEntryElement `xml:"http://www.w3.org/2005/Atom entry"`
+		}{}
+		if err := decoder.Decode(&wrapper); err != nil {
+			return err
+		}
+		feedElement.Entries = append(feedElement.Entries, wrapper.Entries...)
+		return nil
+	}
+	err := decodeLeniently(contentBytes, entryPattern, &feedElement, decodeEntry)
+	return feedElement, err
+}
+
+// Convert Atom entries to our own structures.
+func entryElementsToItems(entries []dxml.AtomEntryElement) []djson.RssItem {
+	rssItems := make([]djson.RssItem, 0, len(entries))
+	for _, each := range entries {
+		var link, license string
+		var enclosure dxml.LinkElement
+		for _, eachLink := range each.Links {
+			switch eachLink.Rel {
+			case "", "alternate":
+				if link == "" {
+					link = eachLink.Href
+				}
+			case "enclosure":
+				if enclosure.Href == "" {
+					enclosure = eachLink
+				}
+			case "license":
+				if license == "" {
+					license = eachLink.Href
+				}
+			}
+		}
+		content := pickContent(each.Contents, each.Groups)
+		if content.URL == "" {
+			content.URL = enclosure.Href
+			content.Type = enclosure.Type
+		}
+		description, descriptionMarkdown := CleanDescription(each.Summary)
+		medium, text := deriveMediumAndText(content, each.Summary)
+		var author string
+		if len(each.Authors) > 0 {
+			author = each.Authors[0].Name
+		}
+		rssItems = append(
+			rssItems,
+			djson.RssItem{
+				Title:           each.Title,
+				Link:            link,
+				GUID:            each.ID,
+				PublicationDate: toRssDate(firstNonEmpty(each.Published, each.Updated)),
+				Author:          firstNonEmpty(author, extractAuthor(each.Credits)),
+				URL:             content.URL,
+				Dimensions: djson.Dimensions{
+					Width:  content.Width,
+					Height: content.Height},
+				License:             newLicense(license),
+				Description:         description,
+				DescriptionMarkdown: descriptionMarkdown,
+				Medium:              medium,
+				Text:                text,
+			})
+	}
+	return rssItems
+}
+
+// Convert RFC 3339 date, e.g. "2024-04-15T08:29:36-07:00", to the format used in RSS. Other
+// values are returned as is.
+func toRssDate(value string) string {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return parsed.Format(time.RFC1123)
+}
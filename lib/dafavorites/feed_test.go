@@ -0,0 +1,83 @@
+package dafavorites
+
+import (
+	"testing"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchAtomFeed(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	httpClient := newTestHTTPClient()
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: httpClient,
+	}
+	feedURL := "https://example.com/atom.xml"
+
+	// EXERCISE
+	fetched := Fetch([]Source{NewFeedSource(feedURL)}, Options{Dirpath: dirp, WorkerCount: 1}, ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Nil(httpClient.err)
+	items := map[string]djson.RssItem{}
+	for _, each := range fetched.SavedDeviations {
+		items[each.RssItem.GUID] = each.RssItem
+		req.Equal([]djson.Origin{{Kind: SourceFeed, FeedURL: feedURL}}, each.Origins)
+	}
+	req.Equal(
+		map[string]djson.RssItem{
+			"urn:example:anna": {
+				Title:           "Anna",
+				Link:            "https://example.com/anna",
+				GUID:            "urn:example:anna",
+				PublicationDate: "Mon, 15 Apr 2024 08:29:36 -0700",
+				Author:          "Painter",
+				URL:             "https://images-wixmp.wixmp.com/anna.jpg",
+				Dimensions:      djson.Dimensions{Width: 800, Height: 600},
+				Medium:          MediumImage,
+			},
+			"urn:example:kat": {
+				Title:           "Kat",
+				Link:            "https://example.com/kat",
+				GUID:            "urn:example:kat",
+				PublicationDate: "Tue, 16 Apr 2024 10:00:00 UTC",
+				Author:          "Sculptor",
+				URL:             "https://images-wixmp.com/kat.jpg",
+				Medium:          MediumImage,
+			},
+		},
+		items)
+	verifyFileContent(req, fsys, dirp, "anna.jpg", fixtureBytes(t, annaImageURL))
+	verifyFileContent(req, fsys, dirp, "kat.jpg", fixtureBytes(t, katImageURL))
+}
+
+func TestFetchRssFeedWithEnclosure(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: newTestHTTPClient(),
+	}
+
+	// EXERCISE
+	fetched := Fetch(
+		[]Source{NewFeedSource("https://example.com/rss.xml")},
+		Options{Dirpath: dirp, WorkerCount: 1},
+		ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Equal(1, len(fetched.SavedDeviations))
+	item := fetched.SavedDeviations[0].RssItem
+	req.Equal("Sculptor", item.Author)
+	req.Equal("https://images-wixmp.com/kat.jpg", item.URL)
+	verifyFileContent(req, fsys, dirp, "kat.jpg", fixtureBytes(t, katImageURL))
+}
@@ -0,0 +1,183 @@
+package dafavorites
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+)
+
+// Operators of filter conditions. Longer ones first so that e.g. ">=" isn't mistaken for ">".
+var filterOperators = []string{"!=", "^=", ">=", "<=", "=", "~", ">", "<"}
+
+// Filter decides which deviations are archived. Deviations that don't pass are skipped.
+type Filter struct {
+	includes []filterCondition
+	excludes []filterCondition
+}
+
+// FilterCondition is a single parsed expression, e.g. "width>=1000".
+type filterCondition struct {
+	expression string
+	field      string
+	operator   string
+	value      string
+	number     int
+	pattern    *regexp.Regexp
+}
+
+// ParseFilter parses include and exclude expressions into a Filter. A deviation passes when it
+// matches all include expressions and none of the exclude expressions. Each expression is a
+// field, an operator and a value, e.g. "author=WojtekFus", "category^=digitalart/paintings",
+// "rating=nonadult", "medium!=literature", "width>=1000" or "title~(?i)dragon".
+//
+// Fields author, category, medium, rating and title support operators "=" and "!=" (case insensitive),
+// "^=" (prefix, case insensitive) and "~" (regular expression). Fields width and height support
+// "=", "!=", ">", ">=", "<" and "<=".
+func ParseFilter(includes, excludes []string) (*Filter, error) {
+	filter := &Filter{}
+	for _, each := range includes {
+		condition, err := parseFilterCondition(each)
+		if err != nil {
+			return nil, err
+		}
+		filter.includes = append(filter.includes, condition)
+	}
+	for _, each := range excludes {
+		condition, err := parseFilterCondition(each)
+		if err != nil {
+			return nil, err
+		}
+		filter.excludes = append(filter.excludes, condition)
+	}
+	return filter, nil
+}
+
+func parseFilterCondition(expression string) (filterCondition, error) {
+	trimmed := strings.TrimSpace(expression)
+	fieldEnd := strings.IndexFunc(trimmed, func(r rune) bool {
+		return r < 'a' || r > 'z'
+	})
+	if fieldEnd <= 0 {
+		return filterCondition{}, fmt.Errorf("missing field in filter %q", expression)
+	}
+	condition := filterCondition{
+		expression: trimmed,
+		field:      trimmed[:fieldEnd],
+	}
+	rest := strings.TrimLeft(trimmed[fieldEnd:], " ")
+	for _, each := range filterOperators {
+		if strings.HasPrefix(rest, each) {
+			condition.operator = each
+			condition.value = strings.TrimSpace(rest[len(each):])
+			break
+		}
+	}
+	if condition.operator == "" {
+		return filterCondition{}, fmt.Errorf("missing operator in filter %q", expression)
+	}
+
+	switch condition.field {
+	case "author", "category", "medium", "rating", "title":
+		if strings.ContainsAny(condition.operator, "<>") {
+			return filterCondition{}, fmt.Errorf(
+				"operator %s not supported for %s in filter %q",
+				condition.operator,
+				condition.field,
+				expression)
+		}
+		if condition.operator == "~" {
+			pattern, err := regexp.Compile(condition.value)
+			if err != nil {
+				return filterCondition{}, fmt.Errorf(
+					"invalid regular expression in filter %q: %w",
+					expression,
+					err)
+			}
+			condition.pattern = pattern
+		}
+	case "width", "height":
+		if condition.operator == "~" || condition.operator == "^=" {
+			return filterCondition{}, fmt.Errorf(
+				"operator %s not supported for %s in filter %q",
+				condition.operator,
+				condition.field,
+				expression)
+		}
+		number, err := strconv.Atoi(condition.value)
+		if err != nil {
+			return filterCondition{}, fmt.Errorf("invalid number in filter %q", expression)
+		}
+		condition.number = number
+	default:
+		return filterCondition{}, fmt.Errorf(
+			"unknown field %q in filter %q",
+			condition.field,
+			expression)
+	}
+	return condition, nil
+}
+
+// Match tells whether item passes the filter. When it doesn't, the reason is returned as well,
+// e.g. "exclude: rating=adult".
+func (v *Filter) Match(item djson.RssItem) (bool, string) {
+	for _, each := range v.includes {
+		if !each.match(item) {
+			return false, "include: " + each.expression
+		}
+	}
+	for _, each := range v.excludes {
+		if each.match(item) {
+			return false, "exclude: " + each.expression
+		}
+	}
+	return true, ""
+}
+
+func (v filterCondition) match(item djson.RssItem) bool {
+	switch v.field {
+	case "width":
+		return v.matchNumber(item.Dimensions.Width)
+	case "height":
+		return v.matchNumber(item.Dimensions.Height)
+	case "author":
+		return v.matchText(item.Author)
+	case "category":
+		return v.matchText(item.Category)
+	case "medium":
+		return v.matchText(item.Medium)
+	case "rating":
+		return v.matchText(item.Rating)
+	}
+	return v.matchText(item.Title)
+}
+
+func (v filterCondition) matchText(text string) bool {
+	switch v.operator {
+	case "=":
+		return strings.EqualFold(text, v.value)
+	case "!=":
+		return !strings.EqualFold(text, v.value)
+	case "^=":
+		return strings.HasPrefix(strings.ToLower(text), strings.ToLower(v.value))
+	}
+	return v.pattern.MatchString(text)
+}
+
+func (v filterCondition) matchNumber(number int) bool {
+	switch v.operator {
+	case "=":
+		return number == v.number
+	case "!=":
+		return number != v.number
+	case ">":
+		return number > v.number
+	case ">=":
+		return number >= v.number
+	case "<":
+		return number < v.number
+	}
+	return number <= v.number
+}
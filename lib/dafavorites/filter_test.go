@@ -0,0 +1,93 @@
+package dafavorites
+
+import (
+	"testing"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterMatch(t *testing.T) {
+	item := djson.RssItem{
+		Title:      "MODEL NO. TH-X11-38",
+		Author:     "WojtekFus",
+		Rating:     "nonadult",
+		Category:   "digitalart/paintings/scifi",
+		Dimensions: djson.Dimensions{Width: 1192, Height: 670},
+		Medium:     MediumImage,
+	}
+	run := func(name string, includes, excludes []string, expected bool, reason string) {
+		t.Run(name, func(t *testing.T) {
+			shared.InitTestLogging(t)
+			filter, err := ParseFilter(includes, excludes)
+			require.Nil(t, err)
+
+			// EXERCISE
+			ok, actualReason := filter.Match(item)
+
+			// VERIFY
+			assert.Equal(t, expected, ok)
+			assert.Equal(t, reason, actualReason)
+		})
+	}
+
+	run("No conditions", nil, nil, true, "")
+	run("Author", []string{"author=wojtekfus"}, nil, true, "")
+	run("Other author", []string{"author=someone"}, nil, false, "include: author=someone")
+	run("Category prefix", []string{"category^=digitalart/paintings"}, nil, true, "")
+	run("Min width", []string{"width >= 1000", "height>=670"}, nil, true, "")
+	run("Too small", []string{"height>670"}, nil, false, "include: height>670")
+	run("Title regex", []string{"title~(?i)^model"}, nil, true, "")
+	run("Exclude rating", nil, []string{"rating=nonadult"}, false, "exclude: rating=nonadult")
+	run("Exclude other", nil, []string{"rating!=nonadult"}, true, "")
+	run("Exclude literature", nil, []string{"medium=literature"}, true, "")
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	run := func(expression string) {
+		t.Run(expression, func(t *testing.T) {
+			shared.InitTestLogging(t)
+			_, err := ParseFilter([]string{expression}, nil)
+			assert.NotNil(t, err)
+		})
+	}
+
+	run("=value")
+	run("author")
+	run("color=red")
+	run("width~1")
+	run("title>a")
+	run("height>=big")
+	run("title~(")
+}
+
+func TestFetchWithFilter(t *testing.T) {
+	shared.InitTestLogging(t)
+	ctx := &TestContext{
+		fsys:       &afero.Afero{Fs: afero.NewMemMapFs()},
+		httpClient: newTestHTTPClient(),
+	}
+	filter, err := ParseFilter(nil, []string{"author=FriesellFly"})
+	require.Nil(t, err)
+
+	// EXERCISE
+	fetched := Fetch(
+		[]Source{NewFavoritesSource("denarced")},
+		Options{Dirpath: "/root", WorkerCount: 1, Filter: filter},
+		ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Equal(1, len(fetched.SavedDeviations))
+	req.Equal("Anna Rose 13", fetched.SavedDeviations[0].RssItem.Title)
+	req.Equal(1, len(fetched.Skipped))
+	skipped := fetched.Skipped[0]
+	req.Equal("Kat", skipped.RssItem.Title)
+	req.Equal("exclude: author=FriesellFly", skipped.Reason)
+	req.Equal(
+		[]djson.Origin{{Kind: SourceFavorites, Username: "denarced"}},
+		skipped.Origins)
+}
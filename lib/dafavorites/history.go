@@ -0,0 +1,131 @@
+package dafavorites
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+)
+
+// Tell whether the image of archived has been replaced in item, the same deviation as it's listed
+// now. The query is ignored in URLs because it contains e.g. access tokens that change all the
+// time.
+func isImageReplaced(archived, item djson.RssItem) bool {
+	// Nothing to compare, e.g. literature or deviations archived without their URLs.
+	if archived.URL == "" || item.URL == "" {
+		return false
+	}
+	if stripQuery(archived.URL) != stripQuery(item.URL) {
+		return true
+	}
+	dimensions := []djson.Dimensions{archived.Dimensions, item.Dimensions}
+	return !slices.Contains(dimensions, djson.Dimensions{}) && dimensions[0] != dimensions[1]
+}
+
+// Strip the query and fragment from rawURL, e.g. "https://a/b.jpg?token=1" -> "https://a/b.jpg".
+func stripQuery(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	return parsed.String()
+}
+
+// Update archived with item, the same deviation as it was found at time at. Changes of the
+// title, the author, the license, the rating and the category are recorded in the history and the
+// description is updated as well. Values that item lacks, e.g. because its source doesn't provide
+// them, are left as they were. The image is left as is, see replaceVersion.
+func updateSeen(
+	archived djson.SavedDeviation,
+	item djson.RssItem,
+	at time.Time,
+) djson.SavedDeviation {
+	current := &archived.RssItem
+	// Copy so that the previous fetch isn't modified.
+	history := slices.Clone(archived.History)
+	history = appendChange(history, at, "title", current.Title, item.Title)
+	history = appendChange(history, at, "author", current.Author, item.Author)
+	history = appendChange(history, at, "license", current.License.URL, item.License.URL)
+	history = appendChange(history, at, "rating", current.Rating, item.Rating)
+	history = appendChange(history, at, "category", current.Category, item.Category)
+	archived.History = history
+	update := func(field *string, value string) {
+		if value != "" {
+			*field = value
+		}
+	}
+	update(&current.Title, item.Title)
+	update(&current.Author, item.Author)
+	if item.License.URL != "" {
+		current.License = item.License
+	}
+	update(&current.Rating, item.Rating)
+	update(&current.Category, item.Category)
+	update(&current.CategoryLabel, item.CategoryLabel)
+	if item.Description != "" {
+		current.Description = item.Description
+		current.DescriptionMarkdown = item.DescriptionMarkdown
+	}
+	archived.LastSeen = at
+	return archived
+}
+
+// Replace archived with replacement, the same deviation downloaded anew at time at because its
+// image was replaced. Archived's file is kept as a previous version and the change of the image's
+// URL and dimensions is recorded in the history.
+func replaceVersion(
+	archived, replacement djson.SavedDeviation,
+	at time.Time,
+) djson.SavedDeviation {
+	history := slices.Clone(archived.History)
+	history = appendChange(history, at, "url", archived.RssItem.URL, replacement.RssItem.URL)
+	history = appendChange(
+		history,
+		at,
+		"dimensions",
+		formatDimensions(archived.RssItem.Dimensions),
+		formatDimensions(replacement.RssItem.Dimensions))
+	replacement.History = history
+	replacement.PreviousVersions = append(
+		slices.Clone(archived.PreviousVersions),
+		djson.PreviousVersion{
+			Filename:   archived.Filename,
+			Size:       archived.Size,
+			SHA256:     archived.SHA256,
+			Blob:       archived.Blob,
+			URL:        archived.RssItem.URL,
+			Dimensions: archived.RssItem.Dimensions,
+			Image:      archived.Image,
+			ReplacedAt: at,
+		})
+	replacement.Origins = archived.Origins
+	replacement.FavoritedBy = archived.FavoritedBy
+	replacement.AuthorAvatar = archived.AuthorAvatar
+	replacement.FirstSeen = archived.FirstSeen
+	replacement.LastSeen = at
+	return replacement
+}
+
+// Append the change of field from old to updated to history unless the value is the same or the
+// new value is missing.
+func appendChange(history []djson.Change, at time.Time, field, old, updated string) []djson.Change {
+	if updated == "" || old == updated {
+		return history
+	}
+	if field == "url" && stripQuery(old) == stripQuery(updated) {
+		return history
+	}
+	return append(history, djson.Change{At: at, Field: field, Old: old, New: updated})
+}
+
+// Format dimensions, e.g. "800x600". Empty when unknown.
+func formatDimensions(dimensions djson.Dimensions) string {
+	if dimensions == (djson.Dimensions{}) {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", dimensions.Width, dimensions.Height)
+}
@@ -0,0 +1,170 @@
+package dafavorites
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchRecordsHistory(t *testing.T) {
+	shared.InitTestLogging(t)
+	favorites := djson.Origin{Kind: SourceFavorites, Username: "david"}
+	previousTimestamp := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	firstSeen := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	renamed := djson.SavedDeviation{
+		RssItem: djson.RssItem{
+			GUID:       "kat",
+			Title:      "Kat",
+			Author:     "Friesellfly",
+			URL:        katImageURL + "?token=1",
+			Dimensions: djson.Dimensions{Width: 2, Height: 2},
+		},
+		Filename:  filepath.Join("1", "kat.jpg"),
+		Origins:   []djson.Origin{favorites},
+		FirstSeen: firstSeen,
+		LastSeen:  previousTimestamp,
+	}
+	replaced := djson.SavedDeviation{
+		RssItem: djson.RssItem{
+			GUID:   "anna",
+			Title:  "Anna",
+			URL:    "https://images-wixmp.com/old-anna.jpg",
+			Medium: MediumImage,
+		},
+		Filename: filepath.Join("2", "old-anna.jpg"),
+		Size:     3,
+		SHA256:   sha256Hex("old"),
+		Origins:  []djson.Origin{favorites},
+	}
+	unseen := djson.SavedDeviation{
+		RssItem:  djson.RssItem{GUID: "unseen"},
+		Filename: filepath.Join("3", "unseen.jpg"),
+	}
+	previous := &djson.DeviantFetch{
+		SavedDeviations: []djson.SavedDeviation{renamed, replaced, unseen},
+		Timestamp:       previousTimestamp,
+	}
+	renamedItem := renamed.RssItem
+	renamedItem.Title = "Kat II"
+	renamedItem.Author = "Painter"
+	renamedItem.URL = katImageURL + "?token=2"
+	renamedItem.License = newLicense("https://creativecommons.org/licenses/by/4.0/")
+	renamedItem.Description = "<b>Kat</b>"
+	renamedItem.DescriptionMarkdown = "**Kat**"
+	replacedItem := replaced.RssItem
+	replacedItem.URL = annaImageURL
+	source := &testSource{
+		pages:  [][]djson.RssItem{{renamedItem, replacedItem}},
+		origin: favorites,
+	}
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: newTestHTTPClient(),
+	}
+
+	// EXERCISE
+	fetched := Fetch(
+		[]Source{source},
+		Options{Dirpath: "/root", WorkerCount: 1, Previous: previous},
+		ctx)
+
+	// VERIFY
+	req := require.New(t)
+	now := fetched.Timestamp
+	req.Equal(3, len(fetched.SavedDeviations))
+
+	first := fetched.SavedDeviations[0]
+	req.Equal("Kat II", first.RssItem.Title)
+	req.Equal("Painter", first.RssItem.Author)
+	req.Equal(renamed.RssItem.URL, first.RssItem.URL, "Only the token changed.")
+	req.Equal(firstSeen, first.FirstSeen)
+	req.Equal(now, first.LastSeen)
+	req.Equal(
+		[]djson.Change{
+			{At: now, Field: "title", Old: "Kat", New: "Kat II"},
+			{At: now, Field: "author", Old: "Friesellfly", New: "Painter"},
+			{
+				At:    now,
+				Field: "license",
+				New:   "https://creativecommons.org/licenses/by/4.0/",
+			},
+		},
+		first.History)
+	req.Equal(renamedItem.License, first.RssItem.License)
+	req.Equal("**Kat**", first.RssItem.DescriptionMarkdown)
+	req.Empty(first.PreviousVersions)
+
+	second := fetched.SavedDeviations[1]
+	req.Equal(annaImageURL, second.RssItem.URL)
+	req.NotEqual(replaced.Filename, second.Filename)
+	req.Equal(previousTimestamp, second.FirstSeen)
+	req.Equal(now, second.LastSeen)
+	req.Equal([]djson.Origin{favorites}, second.Origins)
+	req.Equal(
+		[]djson.Change{
+			{At: now, Field: "url", Old: replaced.RssItem.URL, New: annaImageURL},
+		},
+		second.History)
+	req.Equal(
+		[]djson.PreviousVersion{{
+			Filename:   replaced.Filename,
+			Size:       3,
+			SHA256:     sha256Hex("old"),
+			URL:        replaced.RssItem.URL,
+			ReplacedAt: now,
+		}},
+		second.PreviousVersions)
+	verifyFileContent(req, fsys, "/root", "anna.jpg", fixtureBytes(t, annaImageURL))
+
+	third := fetched.SavedDeviations[2]
+	req.Equal(previousTimestamp, third.FirstSeen)
+	req.Equal(previousTimestamp, third.LastSeen)
+	req.Empty(third.History)
+
+	req.Empty(previous.SavedDeviations[0].History, "Previous fetch shouldn't be modified.")
+}
+
+func TestIsImageReplaced(t *testing.T) {
+	run := func(name string, archived, item djson.RssItem, expected bool) {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, expected, isImageReplaced(archived, item))
+		})
+	}
+
+	small := djson.Dimensions{Width: 10, Height: 10}
+	large := djson.Dimensions{Width: 20, Height: 20}
+	run(
+		"same",
+		djson.RssItem{URL: "https://a/b.jpg", Dimensions: small},
+		djson.RssItem{URL: "https://a/b.jpg", Dimensions: small},
+		false)
+	run(
+		"token changed",
+		djson.RssItem{URL: "https://a/b.jpg?token=1"},
+		djson.RssItem{URL: "https://a/b.jpg?token=2"},
+		false)
+	run(
+		"url changed",
+		djson.RssItem{URL: "https://a/b.jpg"},
+		djson.RssItem{URL: "https://a/c.jpg"},
+		true)
+	run(
+		"dimensions changed",
+		djson.RssItem{URL: "https://a/b.jpg", Dimensions: small},
+		djson.RssItem{URL: "https://a/b.jpg", Dimensions: large},
+		true)
+	run(
+		"dimensions missing",
+		djson.RssItem{URL: "https://a/b.jpg", Dimensions: small},
+		djson.RssItem{URL: "https://a/b.jpg"},
+		false)
+	run("url missing", djson.RssItem{URL: "https://a/b.jpg"}, djson.RssItem{}, false)
+	run("archived url missing", djson.RssItem{}, djson.RssItem{URL: "https://a/b.jpg"}, false)
+}
@@ -0,0 +1,125 @@
+package dafavorites
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	// Register decoders for image.DecodeConfig.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+)
+
+// ErrUnsupportedImage is returned when an image's format can't be inspected.
+var ErrUnsupportedImage = errors.New("unsupported image format")
+
+// InspectImage reads the size and format of an image from its header without decoding the whole
+// image. Truncated images are detected by their missing trailers, e.g. JPEG's end of image marker.
+// Supported formats are JPEG, PNG, GIF and WebP, ErrUnsupportedImage is returned for others.
+func InspectImage(content []byte) (djson.ImageInfo, error) {
+	if bytes.HasPrefix(content, []byte("RIFF")) && len(content) >= 12 &&
+		string(content[8:12]) == "WEBP" {
+		return inspectWebP(content)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if errors.Is(err, image.ErrFormat) {
+		return djson.ImageInfo{}, ErrUnsupportedImage
+	}
+	if err != nil {
+		return djson.ImageInfo{}, fmt.Errorf("corrupt %s image: %w", format, err)
+	}
+	if !hasImageTrailer(content, format) {
+		return djson.ImageInfo{}, fmt.Errorf("truncated %s image", format)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return djson.ImageInfo{}, fmt.Errorf("corrupt %s image: no size", format)
+	}
+	return djson.ImageInfo{Width: config.Width, Height: config.Height, Format: format}, nil
+}
+
+// Tell whether content ends like an image of format should. Padding after the trailer, e.g. null
+// bytes, is ignored.
+func hasImageTrailer(content []byte, format string) bool {
+	var trailer []byte
+	switch format {
+	case "jpeg":
+		// End of image marker.
+		trailer = []byte{0xff, 0xd9}
+	case "png":
+		// The IEND chunk's type and CRC.
+		trailer = []byte{'I', 'E', 'N', 'D', 0xae, 0x42, 0x60, 0x82}
+	case "gif":
+		trailer = []byte{0x3b}
+	default:
+		return true
+	}
+	return bytes.HasSuffix(bytes.TrimRight(content, "\x00\r\n "), trailer)
+}
+
+// Inspect a WebP image. Its size is in the header of the first chunk, see
+// https://developers.google.com/speed/webp/docs/riff_container.
+func inspectWebP(content []byte) (djson.ImageInfo, error) {
+	// The RIFF size excludes the "RIFF" tag and the size itself.
+	if int(binary.LittleEndian.Uint32(content[4:8])) > len(content)-8 {
+		return djson.ImageInfo{}, fmt.Errorf("truncated webp image")
+	}
+	if len(content) < 30 {
+		return djson.ImageInfo{}, fmt.Errorf("corrupt webp image: too short")
+	}
+	var width, height int
+	switch string(content[12:16]) {
+	case "VP8X":
+		width = 1 + int(uint32(content[24])|uint32(content[25])<<8|uint32(content[26])<<16)
+		height = 1 + int(uint32(content[27])|uint32(content[28])<<8|uint32(content[29])<<16)
+	case "VP8 ":
+		if !bytes.Equal(content[23:26], []byte{0x9d, 0x01, 0x2a}) {
+			return djson.ImageInfo{}, fmt.Errorf("corrupt webp image: no start code")
+		}
+		width = int(binary.LittleEndian.Uint16(content[26:28]) & 0x3fff)
+		height = int(binary.LittleEndian.Uint16(content[28:30]) & 0x3fff)
+	case "VP8L":
+		if content[20] != 0x2f {
+			return djson.ImageInfo{}, fmt.Errorf("corrupt webp image: no signature")
+		}
+		bits := binary.LittleEndian.Uint32(content[21:25])
+		width = 1 + int(bits&0x3fff)
+		height = 1 + int(bits>>14&0x3fff)
+	default:
+		return djson.ImageInfo{}, fmt.Errorf("corrupt webp image: unknown chunk")
+	}
+	return djson.ImageInfo{Width: width, Height: height, Format: "webp"}, nil
+}
+
+// Inspect downloaded content of medium whose size in the feed is declared. Return nil for content
+// that isn't an inspectable image and an error for corrupt images.
+func inspectDownload(
+	content []byte,
+	medium string,
+	declared djson.Dimensions,
+) (*djson.ImageInfo, error) {
+	if medium != "" && medium != MediumImage {
+		return nil, nil
+	}
+	info, err := InspectImage(content)
+	if errors.Is(err, ErrUnsupportedImage) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	info.DimensionsMismatch = isDimensionsMismatch(info, declared)
+	return &info, nil
+}
+
+// Tell whether the actual size of an image differs from the one declared in the feed. Unknown
+// declared size is no mismatch.
+func isDimensionsMismatch(info djson.ImageInfo, declared djson.Dimensions) bool {
+	if declared.Width <= 0 || declared.Height <= 0 {
+		return false
+	}
+	return info.Width != declared.Width || info.Height != declared.Height
+}
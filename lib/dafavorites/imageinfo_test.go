@@ -0,0 +1,109 @@
+package dafavorites
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/gif"
+	"testing"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectImage(t *testing.T) {
+	jpeg := fixtureBytes(t, katImageURL)
+	png := fixtureBytes(t, pngImageURL)
+	var gifBuffer bytes.Buffer
+	require.Nil(t, gif.Encode(&gifBuffer, image.NewGray(image.Rect(0, 0, 3, 4)), nil))
+	run := func(name string, content []byte, expected djson.ImageInfo, expectedErr bool) {
+		t.Run(name, func(t *testing.T) {
+			info, err := InspectImage(content)
+			req := require.New(t)
+			req.Equal(expectedErr, err != nil, "%v", err)
+			req.Equal(expected, info)
+		})
+	}
+
+	run("JPEG", jpeg, djson.ImageInfo{Width: 2, Height: 2, Format: "jpeg"}, false)
+	run(
+		"JPEG with padding",
+		append(append([]byte(nil), jpeg...), 0, 0),
+		djson.ImageInfo{Width: 2, Height: 2, Format: "jpeg"},
+		false)
+	run("Truncated JPEG", jpeg[:len(jpeg)-10], djson.ImageInfo{}, true)
+	run("PNG", png, djson.ImageInfo{Width: 2, Height: 2, Format: "png"}, false)
+	run("Truncated PNG", png[:len(png)-4], djson.ImageInfo{}, true)
+	run("GIF", gifBuffer.Bytes(), djson.ImageInfo{Width: 3, Height: 4, Format: "gif"}, false)
+	run("Corrupt", jpeg[:20], djson.ImageInfo{}, true)
+	run("WebP lossless", createWebP("VP8L", 640, 480), djson.ImageInfo{
+		Width:  640,
+		Height: 480,
+		Format: "webp",
+	}, false)
+	run("WebP extended", createWebP("VP8X", 1920, 1080), djson.ImageInfo{
+		Width:  1920,
+		Height: 1080,
+		Format: "webp",
+	}, false)
+	run("Truncated WebP", createWebP("VP8X", 1920, 1080)[:28], djson.ImageInfo{}, true)
+
+	_, err := InspectImage([]byte("BM not supported"))
+	require.ErrorIs(t, err, ErrUnsupportedImage)
+}
+
+// Create the header of a WebP image with chunk, e.g. "VP8L", of size width x height.
+func createWebP(chunk string, width, height int) []byte {
+	content := make([]byte, 40)
+	copy(content, "RIFF")
+	binary.LittleEndian.PutUint32(content[4:8], uint32(len(content)-8))
+	copy(content[8:], "WEBP"+chunk)
+	switch chunk {
+	case "VP8L":
+		content[20] = 0x2f
+		binary.LittleEndian.PutUint32(content[21:25], uint32(width-1)|uint32(height-1)<<14)
+	case "VP8X":
+		for i := 0; i < 3; i++ {
+			content[24+i] = byte((width - 1) >> (8 * i))
+			content[27+i] = byte((height - 1) >> (8 * i))
+		}
+	}
+	return content
+}
+
+func TestFetchInspectsImages(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	httpClient := newTestHTTPClient()
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: httpClient,
+	}
+	source := &testSource{
+		pages: [][]djson.RssItem{{
+			{GUID: "anna", URL: annaImageURL, Dimensions: djson.Dimensions{Width: 2, Height: 2}},
+			{GUID: "kat", URL: katImageURL, Dimensions: djson.Dimensions{Width: 730, Height: 1095}},
+		}},
+		origin: djson.Origin{Kind: SourceFavorites, Username: "denarced"},
+	}
+
+	// EXERCISE
+	fetched := Fetch([]Source{source}, Options{Dirpath: dirp, WorkerCount: 1}, ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Nil(httpClient.err)
+	images := map[string]*djson.ImageInfo{}
+	for _, each := range fetched.SavedDeviations {
+		images[each.RssItem.GUID] = each.Image
+	}
+	req.Equal(
+		map[string]*djson.ImageInfo{
+			"anna": {Width: 2, Height: 2, Format: "jpeg"},
+			"kat":  {Width: 2, Height: 2, Format: "jpeg", DimensionsMismatch: true},
+		},
+		images)
+}
@@ -5,18 +5,146 @@
 // to be public because otherwise JSON marshaling doesn't work.
 package json
 
-import "time"
+import (
+	"strconv"
+	"strings"
+	"time"
+)
 
 // DeviantFetch is one full fetch, all deviations, their saved filenames etc.
 type DeviantFetch struct {
 	SavedDeviations []SavedDeviation
 	Timestamp       time.Time
+	// How each source was listed, one per source.
+	Listings []Listing
+	// Deviations that were found but not downloaded because of a filter.
+	Skipped []SkippedDeviation
+}
+
+// SkippedDeviation is a deviation that was not downloaded because of a filter.
+type SkippedDeviation struct {
+	RssItem RssItem
+	Origins []Origin
+	// Why the deviation was skipped, e.g. "exclude: rating=adult".
+	Reason string
+}
+
+// Listing tells how far a single source was read.
+type Listing struct {
+	Origin Origin
+	// True when the source was read until its end.
+	Complete bool
+	// Why the listing stopped before the end, e.g. "cycle" or "max-pages". Empty when complete.
+	Reason string
+	// The error that stopped the listing when Reason is "error".
+	Error string
+	Pages int
+	Items int
 }
 
 // SavedDeviation is a single saved deviation
 type SavedDeviation struct {
 	RssItem  RssItem
 	Filename string
+	// The size and SHA-256 (hex) of the saved file when it was downloaded.
+	Size   int64
+	SHA256 string
+	// The content-addressed file that Filename links to, e.g. "blobs/ab/ab12...ef.jpg". Empty
+	// when Filename is a file of its own.
+	Blob string
+	// Where the deviation was found, e.g. in user's favorites.
+	Origins []Origin
+	// The users who have favorited the deviation, sorted.
+	FavoritedBy []string
+	// Where the deviation was listed in each of its origins, as of the latest fetch that read the
+	// origin.
+	Positions []Position
+	// The author's avatar, shared by all deviations of the author, e.g. "authors/WojtekFus.jpg".
+	AuthorAvatar string
+	// The saved image as it was inspected, nil when the deviation isn't an image or the
+	// image's format isn't supported.
+	Image *ImageInfo
+	// When the deviation was noticed to have disappeared from all of its origins, nil while it's
+	// still listed. The deviation's files are kept.
+	RemovedAt *time.Time
+	// Why the deviation disappeared, e.g. "deleted" or "unfavorited".
+	RemovedReason string
+	// When the deviation was first and last found from any of its origins.
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Changes of the deviation's metadata, oldest first.
+	History []Change
+	// The files that the artist has since replaced, oldest first. They're kept in the archive.
+	PreviousVersions []PreviousVersion
+}
+
+// Change is a single change of a deviation's metadata noticed in a fetch.
+type Change struct {
+	At time.Time
+	// E.g. "title", "author", "url" or "dimensions".
+	Field string
+	Old   string
+	New   string
+}
+
+// PreviousVersion is a deviation's file that has been replaced with a new version.
+type PreviousVersion struct {
+	Filename   string
+	Size       int64
+	SHA256     string
+	Blob       string
+	URL        string
+	Dimensions Dimensions
+	Image      *ImageInfo
+	// When the new version was downloaded.
+	ReplacedAt time.Time
+}
+
+// Position is where a deviation was listed in an origin, e.g. 1 for the most recent favorite.
+type Position struct {
+	Origin Origin
+	// The page the deviation was listed on, starting from 1.
+	Page int
+	// The position in the whole listing, starting from 1.
+	Position int
+}
+
+// ImageInfo is the actual size and format of a saved image.
+type ImageInfo struct {
+	Width  int
+	Height int
+	// E.g. "jpeg" or "webp".
+	Format string
+	// True when the size differs from the Dimensions in the feed.
+	DimensionsMismatch bool
+}
+
+// Origin is the source of a saved deviation.
+type Origin struct {
+	// The kind of the source, e.g. "favorites" or "gallery".
+	Kind string
+	// The user whose favorites or gallery the deviation was found in.
+	Username string
+	// The favorites collection (folder) the deviation was found in, empty for all favorites.
+	CollectionID   string
+	CollectionName string
+	// The search query that found the deviation, e.g. "tag:landscape".
+	Query string
+	// The URL of the generic feed the deviation was found in.
+	FeedURL string
+}
+
+// CollectionFolders is a single page of user's favorites collections as listed by Deviant Art.
+type CollectionFolders struct {
+	HasMore    bool               `json:"hasMore"`
+	NextOffset int                `json:"nextOffset"`
+	Results    []CollectionFolder `json:"results"`
+}
+
+// CollectionFolder is a single favorites collection.
+type CollectionFolder struct {
+	FolderID int64  `json:"folderId"`
+	Name     string `json:"name"`
 }
 
 // RssItem is a single <item> in deviant art RSS
@@ -28,8 +156,37 @@ type RssItem struct {
 	GUID            string
 	PublicationDate string
 	Author          string
+	// The author's profile, e.g. "http://wojtekfus.deviantart.com".
+	AuthorURL string
+	// The author's avatar image, e.g. "http://a.deviantart.net/avatars/w/o/wojtekfus.jpg?5".
+	AuthorAvatarURL string
 	URL             string
 	Dimensions      Dimensions
+	// E.g. "nonadult" or "adult".
+	Rating string
+	// Category path, e.g. "digitalart/paintings/scifi".
+	Category string
+	// Category's name, e.g. "Sci-Fi".
+	CategoryLabel string
+	// Empty when the deviation has no license.
+	License License
+	// The description as cleaned HTML, with Deviant Art's redirects unwrapped from links.
+	Description string
+	// The description as Markdown.
+	DescriptionMarkdown string
+	// E.g. "image", "video", "document" or "literature".
+	Medium string
+	// Literature's text as Markdown. It's saved in a file of its own and kept here so that the
+	// file can be repaired.
+	Text string `json:",omitempty"`
+}
+
+// License is a deviation's Creative Commons license.
+type License struct {
+	// E.g. "https://creativecommons.org/licenses/by-nc/4.0/".
+	URL string
+	// Normalised short name, e.g. "CC-BY-NC-4.0". Empty for unknown licenses.
+	Name string
 }
 
 // Dimensions of the deviation
@@ -37,3 +194,35 @@ type Dimensions struct {
 	Width  int
 	Height int
 }
+
+// OEmbed is Deviant Art's oEmbed response for a single deviation.
+type OEmbed struct {
+	Type       string  `json:"type"`
+	Title      string  `json:"title"`
+	URL        string  `json:"url"`
+	AuthorName string  `json:"author_name"`
+	AuthorURL  string  `json:"author_url"`
+	PubDate    string  `json:"pubdate"`
+	Safety     string  `json:"safety"`
+	Width      FlexInt `json:"width"`
+	Height     FlexInt `json:"height"`
+}
+
+// FlexInt is an integer that's accepted both as a JSON number and as a JSON string, e.g. 894 and
+// "894". Deviant Art's oEmbed isn't consistent.
+type FlexInt int
+
+// UnmarshalJSON .
+func (v *FlexInt) UnmarshalJSON(data []byte) error {
+	raw := strings.Trim(string(data), `"`)
+	if raw == "" || raw == "null" {
+		*v = 0
+		return nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return err
+	}
+	*v = FlexInt(value)
+	return nil
+}
@@ -0,0 +1,93 @@
+package dafavorites
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+)
+
+// LicenseGroup is the deviations that share a license.
+type LicenseGroup struct {
+	// Zero when the deviations have no license.
+	License    djson.License
+	Deviations []djson.SavedDeviation
+}
+
+// Create a License from licenseURL, e.g. "http://creativecommons.org/licenses/by-nc/3.0/".
+func newLicense(licenseURL string) djson.License {
+	trimmed := strings.TrimSpace(licenseURL)
+	if trimmed == "" {
+		return djson.License{}
+	}
+	return djson.License{URL: trimmed, Name: normalizeLicenseName(trimmed)}
+}
+
+// Derive the short name of the Creative Commons license in licenseURL, e.g. "CC-BY-NC-4.0" for
+// "https://creativecommons.org/licenses/by-nc/4.0/". Names follow SPDX, e.g. "CC-BY-3.0-US" for
+// ported licenses and "CC0-1.0" for public domain dedication. Empty is returned for URLs that
+// aren't Creative Commons licenses.
+func normalizeLicenseName(licenseURL string) string {
+	parsed, err := url.Parse(licenseURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if host != "creativecommons.org" && !strings.HasSuffix(host, ".creativecommons.org") {
+		return ""
+	}
+	segments := strings.FieldsFunc(strings.ToLower(parsed.Path), func(r rune) bool {
+		return r == '/'
+	})
+	if len(segments) < 3 {
+		return ""
+	}
+	kind, version := segments[1], segments[2]
+	var name string
+	switch {
+	case segments[0] == "licenses":
+		name = "CC-" + strings.ToUpper(kind) + "-" + version
+	case segments[0] == "publicdomain" && kind == "zero":
+		name = "CC0-" + version
+	case segments[0] == "publicdomain" && kind == "mark":
+		name = "PDM-" + version
+	default:
+		return ""
+	}
+	// Ported licenses have the jurisdiction after the version, e.g. ".../by/3.0/us/". It may be
+	// followed, or the version directly, by the legal code or a deed, e.g. ".../deed.en".
+	if len(segments) > 3 && segments[3] != "legalcode" && !strings.HasPrefix(segments[3], "deed") {
+		name += "-" + strings.ToUpper(segments[3])
+	}
+	return name
+}
+
+// GroupByLicense groups deviations by license. Groups are sorted by license name, or by URL for
+// unknown licenses, and deviations without a license are the last group.
+func GroupByLicense(deviations []djson.SavedDeviation) []LicenseGroup {
+	indexes := map[djson.License]int{}
+	var groups []LicenseGroup
+	for _, each := range deviations {
+		license := each.RssItem.License
+		if license.Name != "" {
+			// The same license may be written with both http and https.
+			license.URL = ""
+		}
+		index, exists := indexes[license]
+		if !exists {
+			index = len(groups)
+			indexes[license] = index
+			groups = append(groups, LicenseGroup{License: each.RssItem.License})
+		}
+		groups[index].Deviations = append(groups[index].Deviations, each)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		left, right := groups[i].License, groups[j].License
+		if (left.URL == "") != (right.URL == "") {
+			return right.URL == ""
+		}
+		return firstNonEmpty(left.Name, left.URL) < firstNonEmpty(right.Name, right.URL)
+	})
+	return groups
+}
@@ -0,0 +1,94 @@
+package dafavorites
+
+import (
+	"testing"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeLicenseName(t *testing.T) {
+	run := func(name, licenseURL, expected string) {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, expected, normalizeLicenseName(licenseURL))
+		})
+	}
+
+	run("by-nc", "https://creativecommons.org/licenses/by-nc/4.0/", "CC-BY-NC-4.0")
+	run("http", "http://creativecommons.org/licenses/by-nc-nd/3.0/", "CC-BY-NC-ND-3.0")
+	run("no slash", "https://creativecommons.org/licenses/by-sa/4.0", "CC-BY-SA-4.0")
+	run("upper case", "https://CreativeCommons.org/Licenses/BY/2.0/", "CC-BY-2.0")
+	run("ported", "http://creativecommons.org/licenses/by/3.0/us/", "CC-BY-3.0-US")
+	run("deed", "https://creativecommons.org/licenses/by/4.0/deed.en", "CC-BY-4.0")
+	run("legal code", "https://creativecommons.org/licenses/by/4.0/legalcode", "CC-BY-4.0")
+	run("zero", "https://creativecommons.org/publicdomain/zero/1.0/", "CC0-1.0")
+	run("mark", "https://creativecommons.org/publicdomain/mark/1.0/", "PDM-1.0")
+	run("other host", "https://example.com/licenses/by/4.0/", "")
+	run("too short", "https://creativecommons.org/licenses/", "")
+	run("empty", "", "")
+}
+
+func TestToRssFileLicense(t *testing.T) {
+	shared.InitTestLogging(t)
+	content := `<rss version="2.0"
+			xmlns:creativeCommons="http://backend.userland.com/creativeCommonsRssModule">
+		<channel>
+			<item>
+				<title>Licensed</title>
+				<creativeCommons:license>
+					http://creativecommons.org/licenses/by-nc/3.0/
+				</creativeCommons:license>
+			</item>
+			<item>
+				<title>Unlicensed</title>
+			</item>
+		</channel>
+	</rss>`
+
+	// EXERCISE
+	rssFile, err := toRssFile([]byte(content))
+
+	// VERIFY
+	req := require.New(t)
+	req.Nil(err)
+	req.Equal(2, len(rssFile.rssItems))
+	req.Equal(
+		djson.License{
+			URL:  "http://creativecommons.org/licenses/by-nc/3.0/",
+			Name: "CC-BY-NC-3.0",
+		},
+		rssFile.rssItems[0].License)
+	req.Equal(djson.License{}, rssFile.rssItems[1].License)
+}
+
+func TestGroupByLicense(t *testing.T) {
+	var deviations []djson.SavedDeviation
+	for _, each := range []string{
+		"https://creativecommons.org/licenses/by-nc/4.0/",
+		"",
+		"https://creativecommons.org/licenses/by/4.0/",
+		"http://creativecommons.org/licenses/by-nc/4.0/",
+		"https://example.com/license",
+	} {
+		deviations = append(
+			deviations,
+			djson.SavedDeviation{RssItem: djson.RssItem{Title: each, License: newLicense(each)}})
+	}
+	byNc, none, by := deviations[0], deviations[1], deviations[2]
+	byNcHTTP, other := deviations[3], deviations[4]
+
+	// EXERCISE
+	groups := GroupByLicense(deviations)
+
+	// VERIFY
+	req := require.New(t)
+	req.Equal(
+		[]LicenseGroup{
+			{License: by.RssItem.License, Deviations: []djson.SavedDeviation{by}},
+			{License: byNc.RssItem.License, Deviations: []djson.SavedDeviation{byNc, byNcHTTP}},
+			{License: other.RssItem.License, Deviations: []djson.SavedDeviation{other}},
+			{Deviations: []djson.SavedDeviation{none}},
+		},
+		groups)
+}
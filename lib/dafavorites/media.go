@@ -0,0 +1,95 @@
+package dafavorites
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	dxml "github.com/denarced/dafavorites/lib/dafavorites/xml"
+	"github.com/denarced/dafavorites/shared/shared"
+)
+
+// Media of deviations.
+const (
+	MediumImage = "image"
+	MediumVideo = "video"
+	MediumAudio = "audio"
+	// E.g. a PDF.
+	MediumDocument = "document"
+	MediumFlash    = "flash"
+	// Text without a file to download, saved as Markdown.
+	MediumLiterature = "literature"
+)
+
+// Derive the medium of content from its medium attribute, MIME type and, as a last resort, the
+// extension in its URL. Content without a URL is literature.
+func deriveMedium(content dxml.ItemContentElement) string {
+	if content.URL == "" {
+		return MediumLiterature
+	}
+	mimeType := strings.ToLower(strings.TrimSpace(content.Type))
+	extension := strings.ToLower(path.Ext(deriveFilename("", content.URL)))
+	switch {
+	case mimeType == "application/x-shockwave-flash" || extension == ".swf":
+		return MediumFlash
+	case mimeType == "application/pdf" || extension == ".pdf":
+		return MediumDocument
+	}
+	switch medium := strings.ToLower(strings.TrimSpace(content.Medium)); medium {
+	case MediumImage, MediumVideo, MediumAudio, MediumDocument:
+		return medium
+	}
+	for _, each := range []string{MediumImage, MediumVideo, MediumAudio} {
+		if strings.HasPrefix(mimeType, each+"/") {
+			return each
+		}
+	}
+	switch extension {
+	case ".mp4", ".webm", ".mov", ".m4v":
+		return MediumVideo
+	case ".mp3", ".ogg", ".wav", ".m4a":
+		return MediumAudio
+	}
+	return MediumImage
+}
+
+// Derive the medium and text of an item whose downloadable content is content. Only literature
+// has text: text is the first non-empty of texts, e.g. <media:text> and the description, as
+// Markdown.
+func deriveMediumAndText(content dxml.ItemContentElement, texts ...string) (string, string) {
+	medium := deriveMedium(content)
+	if medium != MediumLiterature {
+		return medium, ""
+	}
+	_, markdown := CleanDescription(firstNonEmpty(texts...))
+	if markdown == "" {
+		// Nothing to save.
+		return "", ""
+	}
+	return MediumLiterature, markdown
+}
+
+// Save literature item as Markdown into directory dirpath. Return the file's filepath or empty on
+// failure.
+func saveLiterature(dirpath string, item djson.RssItem, ctx Context) string {
+	if err := ctx.Fsys().MkdirAll(dirpath, 0700); err != nil {
+		shared.Logger.Error("Failed to create path.", "dirpath", dirpath, "error", err)
+		return ""
+	}
+	var content strings.Builder
+	if item.Title != "" {
+		content.WriteString("# " + markdownEscaper.Replace(item.Title) + "\n\n")
+	}
+	if item.Author != "" {
+		content.WriteString("By " + markdownEscaper.Replace(item.Author) + "\n\n")
+	}
+	content.WriteString(item.Text + "\n")
+	fpath := filepath.Join(dirpath, sanitizeFilename(item.Title)+".md")
+	if err := ctx.Fsys().WriteFile(fpath, []byte(content.String()), 0600); err != nil {
+		shared.Logger.Error("Failed to write literature.", "filepath", fpath, "error", err)
+		return ""
+	}
+	shared.Logger.Debug("Literature saved.", "filepath", fpath)
+	return fpath
+}
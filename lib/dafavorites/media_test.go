@@ -0,0 +1,95 @@
+package dafavorites
+
+import (
+	"testing"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	dxml "github.com/denarced/dafavorites/lib/dafavorites/xml"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeriveMedium(t *testing.T) {
+	run := func(name string, content dxml.ItemContentElement, expected string) {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, expected, deriveMedium(content))
+		})
+	}
+
+	run("No URL", dxml.ItemContentElement{}, MediumLiterature)
+	run("Image", dxml.ItemContentElement{URL: "https://a/b.jpg", Medium: "image"}, MediumImage)
+	run("Video", dxml.ItemContentElement{URL: "https://a/b", Medium: "video"}, MediumVideo)
+	run("Video type", dxml.ItemContentElement{URL: "https://a/b", Type: "video/mp4"}, MediumVideo)
+	run("Video extension", dxml.ItemContentElement{URL: "https://a/b.webm?t=1"}, MediumVideo)
+	run("PDF", dxml.ItemContentElement{URL: "https://a/b.pdf", Medium: "document"}, MediumDocument)
+	run(
+		"PDF type",
+		dxml.ItemContentElement{URL: "https://a/b", Type: "application/pdf"},
+		MediumDocument)
+	run("Flash", dxml.ItemContentElement{URL: "https://a/b.swf", Medium: "video"}, MediumFlash)
+	run("Unknown", dxml.ItemContentElement{URL: "https://a/b"}, MediumImage)
+}
+
+func TestToRssFileMedia(t *testing.T) {
+	shared.InitTestLogging(t)
+	content := `<rss version="2.0" xmlns:media="http://search.yahoo.com/mrss/">
+		<channel>
+			<item>
+				<title>Video</title>
+				<media:content url="https://a/preview.jpg" width="800" height="600" medium="image"/>
+				<media:content url="https://a/original.mp4" medium="video"/>
+			</item>
+			<item>
+				<title>Poem</title>
+				<media:text type="html">Roses are &lt;b&gt;red&lt;/b&gt;</media:text>
+			</item>
+			<item>
+				<title>Nothing</title>
+			</item>
+		</channel>
+	</rss>`
+
+	// EXERCISE
+	rssFile, err := toRssFile([]byte(content))
+
+	// VERIFY
+	req := require.New(t)
+	req.Nil(err)
+	req.Equal(3, len(rssFile.rssItems))
+	req.Equal("https://a/original.mp4", rssFile.rssItems[0].URL)
+	req.Equal(MediumVideo, rssFile.rssItems[0].Medium)
+	req.Equal(MediumLiterature, rssFile.rssItems[1].Medium)
+	req.Equal("Roses are **red**", rssFile.rssItems[1].Text)
+	req.Equal("", rssFile.rssItems[2].Medium)
+}
+
+func TestFetchSavesLiterature(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: newTestHTTPClient(),
+	}
+	source := &testSource{
+		pages: [][]djson.RssItem{{{
+			Title:  "Poem",
+			GUID:   "poem",
+			Author: "Poet",
+			Medium: MediumLiterature,
+			Text:   "Roses are **red**",
+		}}},
+		origin: djson.Origin{Kind: SourceFavorites, Username: "denarced"},
+	}
+
+	// EXERCISE
+	fetched := Fetch([]Source{source}, Options{Dirpath: dirp, WorkerCount: 1}, ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Equal(1, len(fetched.SavedDeviations))
+	req.Regexp(`^[0-9a-f-]+/Poem\.md$`, fetched.SavedDeviations[0].Filename)
+	expected := "# Poem\n\nBy Poet\n\nRoses are **red**\n"
+	verifyFileContent(req, fsys, dirp, "Poem.md", []byte(expected))
+}
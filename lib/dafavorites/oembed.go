@@ -0,0 +1,134 @@
+package dafavorites
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	dxml "github.com/denarced/dafavorites/lib/dafavorites/xml"
+	"github.com/denarced/dafavorites/shared/shared"
+)
+
+const (
+	oEmbedURL = "https://backend.deviantart.com/oembed"
+	// SourceURL is the origin kind of deviations given by URL.
+	SourceURL = "url"
+	// How many URLs are resolved for a single page of a URL list.
+	urlPageSize = 10
+)
+
+// ResolveDeviation resolves the deviation in deviationURL to an RssItem with Deviant Art's oEmbed
+// endpoint. The URL is canonicalized first so that the deviation gets the same GUID as in RSS.
+// Deviations that oEmbed can't resolve aren't looked up from their pages.
+func ResolveDeviation(deviationURL string, ctx Context) (djson.RssItem, error) {
+	deviationURL = canonicalizeDeviationURL(deviationURL)
+	endpoint := oEmbedURL + "?url=" + url.QueryEscape(deviationURL)
+	shared.Logger.Debug("About to resolve deviation.", "url", endpoint)
+	bytes, err := ctx.CreateClient().Fetch(endpoint)
+	if err != nil {
+		shared.Logger.Error("Failed to fetch oEmbed.", "url", endpoint, "error", err)
+		return djson.RssItem{}, err
+	}
+	var oEmbed djson.OEmbed
+	if err := json.Unmarshal(bytes, &oEmbed); err != nil {
+		shared.Logger.Error("Failed to parse oEmbed.", "url", endpoint, "error", err)
+		return djson.RssItem{}, fmt.Errorf("invalid oEmbed for %s: %w", deviationURL, err)
+	}
+	return oEmbedToItem(deviationURL, oEmbed), nil
+}
+
+// Convert oEmbed of the deviation in deviationURL to our own structure.
+func oEmbedToItem(deviationURL string, oEmbed djson.OEmbed) djson.RssItem {
+	content := dxml.ItemContentElement{URL: oEmbed.URL}
+	switch oEmbed.Type {
+	case "photo":
+		content.Medium = MediumImage
+	case "video":
+		content.Medium = MediumVideo
+	}
+	// OEmbed doesn't contain literature's text.
+	medium, _ := deriveMediumAndText(content)
+	return djson.RssItem{
+		Title:           oEmbed.Title,
+		Link:            deviationURL,
+		GUID:            deviationURL,
+		PublicationDate: toRssDate(oEmbed.PubDate),
+		Author:          oEmbed.AuthorName,
+		AuthorURL:       oEmbed.AuthorURL,
+		URL:             oEmbed.URL,
+		Dimensions: djson.Dimensions{
+			Width:  int(oEmbed.Width),
+			Height: int(oEmbed.Height),
+		},
+		Rating: oEmbed.Safety,
+		Medium: medium,
+	}
+}
+
+// Canonicalize deviationURL to the form RSS uses, e.g.
+// "https://www.deviantart.com/friesellfly/art/Kat-1042398875": without query, fragment or trailing
+// slash and with the artist in the path instead of the old "friesellfly.deviantart.com" host. URLs
+// of other sites are only trimmed.
+func canonicalizeDeviationURL(deviationURL string) string {
+	deviationURL = strings.TrimSpace(deviationURL)
+	parsed, err := url.Parse(deviationURL)
+	if err != nil {
+		return deviationURL
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if host != "deviantart.com" && !strings.HasSuffix(host, ".deviantart.com") {
+		return deviationURL
+	}
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if user, found := strings.CutSuffix(host, ".deviantart.com"); found && user != "www" {
+		segments = append([]string{user}, segments...)
+	}
+	if len(segments) < 3 || segments[1] != "art" {
+		return deviationURL
+	}
+	segments[0] = strings.ToLower(segments[0])
+	return "https://www.deviantart.com/" + strings.Join(segments, "/")
+}
+
+// URLListSource resolves deviation URLs into items.
+type urlListSource struct {
+	urls []string
+}
+
+// NewURLListSource creates a Source for the deviations in urls. Deviations that can't be resolved
+// are logged and skipped.
+func NewURLListSource(urls []string) Source {
+	return &urlListSource{urls: urls}
+}
+
+func (v *urlListSource) Next(ctx Context) ([]djson.RssItem, error) {
+	if len(v.urls) == 0 {
+		return nil, io.EOF
+	}
+	count := urlPageSize
+	if len(v.urls) < count {
+		count = len(v.urls)
+	}
+	var items []djson.RssItem
+	for _, each := range v.urls[:count] {
+		item, err := ResolveDeviation(each, ctx)
+		if err != nil {
+			// One bad URL shouldn't prevent fetching the rest.
+			continue
+		}
+		items = append(items, item)
+	}
+	v.urls = v.urls[count:]
+	return items, nil
+}
+
+func (v *urlListSource) hasNext() bool {
+	return len(v.urls) > 0
+}
+
+func (*urlListSource) Origin() djson.Origin {
+	return djson.Origin{Kind: SourceURL}
+}
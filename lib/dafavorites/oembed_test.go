@@ -0,0 +1,73 @@
+package dafavorites
+
+import (
+	"testing"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchURLList(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: newTestHTTPClient(),
+	}
+	katURL := "https://www.deviantart.com/friesellfly/art/Kat-1042398875"
+	source := NewURLListSource([]string{
+		"https://www.deviantart.com/nobody/art/Missing-1",
+		katURL + "?utm_source=share#comments",
+		"https://FriesellFly.deviantart.com/art/Kat-1042398875/",
+	})
+
+	// EXERCISE
+	fetched := Fetch([]Source{source}, Options{Dirpath: dirp, WorkerCount: 1}, ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Equal(
+		1,
+		len(fetched.SavedDeviations),
+		"Unresolved URL should be skipped and the rest merged.")
+	req.Equal(
+		djson.RssItem{
+			Title:           "Kat",
+			Link:            katURL,
+			GUID:            katURL,
+			PublicationDate: "Mon, 15 Apr 2024 08:29:36 -0700",
+			Author:          "FriesellFly",
+			AuthorURL:       "https://www.deviantart.com/friesellfly",
+			URL:             "https://images-wixmp.com/kat.jpg",
+			Dimensions:      djson.Dimensions{Width: 730, Height: 1095},
+			Rating:          "nonadult",
+			Medium:          MediumImage,
+		},
+		fetched.SavedDeviations[0].RssItem)
+	req.Equal([]djson.Origin{{Kind: SourceURL}}, fetched.SavedDeviations[0].Origins)
+	verifyFileContent(req, fsys, dirp, "kat.jpg", fixtureBytes(t, katImageURL))
+}
+
+func TestCanonicalizeDeviationURL(t *testing.T) {
+	run := func(name, deviationURL, expected string) {
+		t.Run(name, func(t *testing.T) {
+			shared.InitTestLogging(t)
+			require.Equal(t, expected, canonicalizeDeviationURL(deviationURL))
+		})
+	}
+
+	katURL := "https://www.deviantart.com/friesellfly/art/Kat-1042398875"
+	run("Canonical", katURL, katURL)
+	run("Query and fragment", katURL+"?utm_source=share#comments", katURL)
+	run("Trailing slash", katURL+"/", katURL)
+	run("HTTP", "http://www.deviantart.com/friesellfly/art/Kat-1042398875", katURL)
+	run("No www", "https://deviantart.com/FriesellFly/art/Kat-1042398875", katURL)
+	run("Old host", "https://friesellfly.deviantart.com/art/Kat-1042398875", katURL)
+	run("Whitespace", " "+katURL+"\t", katURL)
+	profileURL := "https://www.deviantart.com/friesellfly"
+	run("Not a deviation", profileURL, profileURL)
+	run("Other site", "https://example.com/art/Kat?x=1", "https://example.com/art/Kat?x=1")
+}
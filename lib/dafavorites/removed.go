@@ -0,0 +1,123 @@
+package dafavorites
+
+import (
+	"net/http"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+)
+
+const (
+	// RemovedDeleted means that the deviation itself no longer exists.
+	RemovedDeleted = "deleted"
+	// RemovedUnfavorited means that the deviation exists but it's no longer a favorite.
+	RemovedUnfavorited = "unfavorited"
+	// RemovedUnlisted means that the deviation exists but it's no longer listed, e.g. in a gallery
+	// or a feed.
+	RemovedUnlisted = "unlisted"
+	// RemovedUnknown means that whether the deviation exists couldn't be checked.
+	RemovedUnknown = "unknown"
+)
+
+// Mark the deviations in merged that disappeared, i.e. that weren't found now from any of their
+// origins. Because a listing that was truncated can't tell what's missing, deviations are only
+// marked when all of their origins were listed completely. Deviations that were marked earlier
+// but were found again are unmarked. Origins maps the keys of the deviations found now to their
+// origins.
+func markRemoved(
+	merged djson.DeviantFetch,
+	origins map[string][]djson.Origin,
+	ctx Context,
+) {
+	complete := map[djson.Origin]bool{}
+	for _, each := range merged.Listings {
+		if isExhaustive(each) {
+			complete[each.Origin] = true
+		}
+	}
+	var client HTTPClient
+	for i := range merged.SavedDeviations {
+		each := &merged.SavedDeviations[i]
+		_, found := origins[deviationKey(each.RssItem)]
+		if found {
+			if each.RemovedAt != nil {
+				shared.Logger.Info("Removed deviation found again.", "filename", each.Filename)
+				each.RemovedAt = nil
+				each.RemovedReason = ""
+			}
+			continue
+		}
+		if each.RemovedAt != nil || !isListedCompletely(each.Origins, complete) {
+			continue
+		}
+		if client == nil {
+			client = ctx.CreateClient()
+		}
+		removedAt := merged.Timestamp
+		each.RemovedAt = &removedAt
+		each.RemovedReason = deriveRemovedReason(*each, client)
+		shared.Logger.Info(
+			"Deviation removed.",
+			"filename", each.Filename,
+			"reason", each.RemovedReason)
+	}
+}
+
+// Tell whether listing enumerated all deviations of its origin. A list of URLs never does
+// because each run lists only the URLs given to it.
+func isExhaustive(listing djson.Listing) bool {
+	return listing.Complete && listing.Origin.Kind != SourceURL
+}
+
+// Tell whether all origins were listed completely. False if there are no origins.
+func isListedCompletely(origins []djson.Origin, complete map[djson.Origin]bool) bool {
+	for _, each := range origins {
+		if !complete[each] {
+			return false
+		}
+	}
+	return len(origins) > 0
+}
+
+// Derive why deviation disappeared by checking whether its page still exists.
+func deriveRemovedReason(deviation djson.SavedDeviation, client HTTPClient) string {
+	if deviation.RssItem.Link == "" {
+		return RemovedUnknown
+	}
+	response, err := client.Download(deviation.RssItem.Link)
+	if err != nil {
+		shared.Logger.Warn(
+			"Failed to check deviation.",
+			"link", deviation.RssItem.Link,
+			"error", err)
+		return RemovedUnknown
+	}
+	switch {
+	case response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusGone:
+		return RemovedDeleted
+	case response.StatusCode < 200 || response.StatusCode >= 300:
+		shared.Logger.Warn(
+			"Unexpected status when checking deviation.",
+			"link", deviation.RssItem.Link,
+			"status", response.StatusCode)
+		return RemovedUnknown
+	}
+	for _, each := range deviation.Origins {
+		if each.Kind == SourceFavorites {
+			return RemovedUnfavorited
+		}
+	}
+	return RemovedUnlisted
+}
+
+// NewlyRemoved returns the deviations of deviantFetch that were noticed to have disappeared in the
+// fetch itself rather than in an earlier one.
+func NewlyRemoved(deviantFetch djson.DeviantFetch) []djson.SavedDeviation {
+	var removed []djson.SavedDeviation
+	for _, each := range deviantFetch.SavedDeviations {
+		if each.RemovedAt != nil && each.RemovedAt.Equal(deviantFetch.Timestamp) {
+			removed = append(removed, each)
+		}
+	}
+	return removed
+}
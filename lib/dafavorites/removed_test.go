@@ -0,0 +1,155 @@
+package dafavorites
+
+import (
+	"testing"
+	"time"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchMarksRemoved(t *testing.T) {
+	shared.InitTestLogging(t)
+	favorites := djson.Origin{Kind: SourceFavorites, Username: "david"}
+	gallery := djson.Origin{Kind: SourceGallery, Username: "david"}
+	earlier := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	previous := &djson.DeviantFetch{}
+	// Links with a fixture exist, others are deleted.
+	for _, each := range []struct {
+		guid          string
+		link          string
+		origins       []djson.Origin
+		removedReason string
+	}{
+		{"kept", "https://example.com/kept", []djson.Origin{favorites}, ""},
+		{"unfavorited", "https://example.com/atom.xml", []djson.Origin{favorites}, ""},
+		{"deleted", "https://example.com/deleted", []djson.Origin{favorites}, ""},
+		{"not-listed", "https://example.com/deleted", []djson.Origin{favorites, gallery}, ""},
+		{
+			"removed-earlier",
+			"https://example.com/atom.xml",
+			[]djson.Origin{favorites},
+			RemovedUnfavorited,
+		},
+		{"restored", "https://example.com/restored", []djson.Origin{favorites}, RemovedDeleted},
+	} {
+		deviation := djson.SavedDeviation{
+			RssItem:  djson.RssItem{GUID: each.guid, Link: each.link},
+			Filename: each.guid + ".jpg",
+			Origins:  each.origins,
+		}
+		if each.removedReason != "" {
+			deviation.RemovedAt = &earlier
+			deviation.RemovedReason = each.removedReason
+		}
+		previous.SavedDeviations = append(previous.SavedDeviations, deviation)
+	}
+	kept, restored := previous.SavedDeviations[0], previous.SavedDeviations[5]
+	source := &testSource{
+		pages:  [][]djson.RssItem{{kept.RssItem, restored.RssItem}},
+		origin: favorites,
+	}
+	ctx := &TestContext{
+		fsys:       &afero.Afero{Fs: afero.NewMemMapFs()},
+		httpClient: newTestHTTPClient(),
+	}
+
+	// EXERCISE
+	fetched := Fetch(
+		[]Source{source},
+		Options{Dirpath: "/root", WorkerCount: 1, Previous: previous},
+		ctx)
+
+	// VERIFY
+	req := require.New(t)
+	removed := map[string]string{}
+	removedAt := map[string]time.Time{}
+	for _, each := range fetched.SavedDeviations {
+		if each.RemovedAt != nil {
+			removed[each.RssItem.GUID] = each.RemovedReason
+			removedAt[each.RssItem.GUID] = *each.RemovedAt
+		}
+	}
+	req.Equal(
+		map[string]string{
+			"unfavorited":     RemovedUnfavorited,
+			"deleted":         RemovedDeleted,
+			"removed-earlier": RemovedUnfavorited,
+		},
+		removed)
+	var newlyRemoved []string
+	for _, each := range NewlyRemoved(fetched) {
+		newlyRemoved = append(newlyRemoved, each.RssItem.GUID)
+	}
+	req.Equal([]string{"unfavorited", "deleted"}, newlyRemoved)
+	req.Equal(earlier, removedAt["removed-earlier"])
+	req.Nil(previous.SavedDeviations[1].RemovedAt, "Previous fetch shouldn't be modified.")
+}
+
+func TestFetchDoesntMarkRemovedWhenTruncated(t *testing.T) {
+	shared.InitTestLogging(t)
+	favorites := djson.Origin{Kind: SourceFavorites, Username: "david"}
+	previous := &djson.DeviantFetch{
+		SavedDeviations: []djson.SavedDeviation{{
+			RssItem:  djson.RssItem{GUID: "old", Link: "https://example.com/deleted"},
+			Filename: "old.jpg",
+			Origins:  []djson.Origin{favorites},
+		}},
+	}
+	source := &testSource{
+		pages: [][]djson.RssItem{
+			{{GUID: "new", URL: katImageURL}},
+			{{GUID: "newer", URL: annaImageURL}},
+		},
+		origin: favorites,
+	}
+	ctx := &TestContext{
+		fsys:       &afero.Afero{Fs: afero.NewMemMapFs()},
+		httpClient: newTestHTTPClient(),
+	}
+
+	// EXERCISE
+	fetched := Fetch(
+		[]Source{source},
+		Options{Dirpath: "/root", WorkerCount: 1, Previous: previous, MaxPages: 1},
+		ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Equal(2, len(fetched.SavedDeviations))
+	req.Nil(fetched.SavedDeviations[0].RemovedAt)
+	req.Empty(NewlyRemoved(fetched))
+}
+
+func TestFetchDoesntMarkRemovedFromURLList(t *testing.T) {
+	shared.InitTestLogging(t)
+	katURL := "https://www.deviantart.com/friesellfly/art/Kat-1042398875"
+	// Added by an earlier list of URLs, still exists.
+	previous := &djson.DeviantFetch{
+		SavedDeviations: []djson.SavedDeviation{{
+			RssItem:  djson.RssItem{GUID: "earlier", Link: "https://example.com/atom.xml"},
+			Filename: "earlier.jpg",
+			Origins:  []djson.Origin{{Kind: SourceURL}},
+		}},
+	}
+	ctx := &TestContext{
+		fsys:       &afero.Afero{Fs: afero.NewMemMapFs()},
+		httpClient: newTestHTTPClient(),
+	}
+
+	// EXERCISE
+	fetched := Fetch(
+		[]Source{NewURLListSource([]string{katURL})},
+		Options{Dirpath: "/root", WorkerCount: 1, Previous: previous},
+		ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Equal(2, len(fetched.SavedDeviations))
+	for _, each := range fetched.SavedDeviations {
+		req.Nil(each.RemovedAt, each.RssItem.GUID)
+	}
+	req.Empty(NewlyRemoved(fetched))
+}
@@ -0,0 +1,226 @@
+package dafavorites
+
+import (
+	"path/filepath"
+	"slices"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+)
+
+// RepairReport tells which files Repair re-downloaded. All filepaths are relative to the
+// archive's directory.
+type RepairReport struct {
+	Repaired []string
+	// Files that couldn't be re-downloaded, by the filepath in the manifest.
+	Failed []string
+}
+
+// Repair re-downloads the missing and corrupt files of the archive in directory dirpath and
+// returns its manifest deviantFetch updated. A file is corrupt when its checksum doesn't match or,
+// if it has no checksum, when it's an image that can't be inspected. Each file is downloaded again
+// from the URL in the manifest and, if that fails e.g. because the URL has expired, from a URL
+// resolved anew for the deviation. Previous versions of deviations are downloaded again only from
+// their recorded URLs. Missing avatars are downloaded again as well.
+func Repair(
+	dirpath string,
+	deviantFetch djson.DeviantFetch,
+	ctx Context,
+) (djson.DeviantFetch, RepairReport, error) {
+	report := RepairReport{}
+	verifyReport, err := Verify(dirpath, deviantFetch, nil, ctx)
+	if err != nil {
+		return deviantFetch, report, err
+	}
+	broken := map[string]bool{}
+	for _, each := range verifyReport.Missing {
+		broken[each] = true
+	}
+	for _, each := range verifyReport.Changed {
+		broken[each] = true
+	}
+	unchecked := map[string]bool{}
+	for _, each := range verifyReport.Unchecked {
+		unchecked[each] = true
+	}
+	for _, deviation := range deviantFetch.SavedDeviations {
+		for _, each := range listDeviationFiles(deviation) {
+			if unchecked[each.filename] &&
+				!isIntact(dirpath, each.filename, deviation.RssItem.Medium, ctx) {
+				broken[each.filename] = true
+			}
+		}
+	}
+
+	// Copy so that the given manifest isn't modified.
+	deviations := append([]djson.SavedDeviation(nil), deviantFetch.SavedDeviations...)
+	for i := range deviations {
+		each := &deviations[i]
+		if broken[each.AuthorAvatar] {
+			each.AuthorAvatar = ""
+		}
+		each.PreviousVersions = repairVersions(dirpath, *each, broken, &report, ctx)
+		if !broken[each.Filename] {
+			continue
+		}
+		repaired, ok := redownload(dirpath, *each, true, ctx)
+		if !ok {
+			report.Failed = append(report.Failed, each.Filename)
+			continue
+		}
+		report.Repaired = append(report.Repaired, repaired.Filename)
+		*each = repaired
+	}
+	saveAuthorAvatars(dirpath, deviations, ctx)
+	deviantFetch.SavedDeviations = deviations
+	return deviantFetch, report, nil
+}
+
+// Re-download the broken previous versions of deviation from their recorded URLs. Return the
+// versions updated. The deviation isn't resolved anew for them because that would give the
+// current version.
+func repairVersions(
+	dirpath string,
+	deviation djson.SavedDeviation,
+	broken map[string]bool,
+	report *RepairReport,
+	ctx Context,
+) []djson.PreviousVersion {
+	// Copy so that the given manifest isn't modified.
+	versions := slices.Clone(deviation.PreviousVersions)
+	for i := range versions {
+		each := &versions[i]
+		if !broken[each.Filename] {
+			continue
+		}
+		repaired, ok := redownload(
+			dirpath,
+			djson.SavedDeviation{
+				RssItem: djson.RssItem{
+					URL:        each.URL,
+					Medium:     deviation.RssItem.Medium,
+					Dimensions: each.Dimensions,
+				},
+				Filename: each.Filename,
+				Size:     each.Size,
+				SHA256:   each.SHA256,
+				Blob:     each.Blob,
+			},
+			false,
+			ctx)
+		if !ok {
+			report.Failed = append(report.Failed, each.Filename)
+			continue
+		}
+		report.Repaired = append(report.Repaired, repaired.Filename)
+		each.Filename = repaired.Filename
+		each.Size = repaired.Size
+		each.SHA256 = repaired.SHA256
+		each.Blob = repaired.Blob
+		each.Image = repaired.Image
+	}
+	return versions
+}
+
+// Tell whether file filename, which has no checksum, is intact. Only images can be checked.
+func isIntact(dirpath, filename, medium string, ctx Context) bool {
+	content, err := ctx.Fsys().ReadFile(filepath.Join(dirpath, filename))
+	if err != nil {
+		return false
+	}
+	_, err = inspectDownload(content, medium, djson.Dimensions{})
+	return err == nil
+}
+
+// Download deviation again into the directory where it was. If resolve is true and the URL
+// fails, the deviation is resolved anew by its link. Return the deviation updated and whether it
+// succeeded.
+func redownload(
+	dirpath string,
+	deviation djson.SavedDeviation,
+	resolve bool,
+	ctx Context,
+) (djson.SavedDeviation, bool) {
+	item := deviation.RssItem
+	if deviation.Blob != "" {
+		// Don't write through the link into the blob, it's replaced as a whole.
+		_ = ctx.Fsys().Remove(filepath.Join(dirpath, deviation.Filename))
+	}
+	absoluteFilep, imageInfo := redownloadItem(dirpath, deviation.Filename, item, ctx)
+	// Literature isn't downloaded so resolving it anew wouldn't help.
+	if absoluteFilep == "" && resolve && item.Medium != MediumLiterature && item.Link != "" {
+		shared.Logger.Info("Resolving deviation anew.", "link", item.Link)
+		resolved, err := ResolveDeviation(item.Link, ctx)
+		if err == nil && resolved.URL != "" && resolved.URL != item.URL {
+			item.URL = resolved.URL
+			absoluteFilep, imageInfo = redownloadItem(dirpath, deviation.Filename, item, ctx)
+		}
+	}
+	if absoluteFilep == "" {
+		shared.Logger.Error("Failed to repair deviation.", "filename", deviation.Filename)
+		return deviation, false
+	}
+	size, sum, err := checksumFile(absoluteFilep, ctx)
+	if err != nil {
+		shared.Logger.Error("Failed to checksum file.", "filepath", absoluteFilep, "error", err)
+		return deviation, false
+	}
+	if deviation.Blob != "" {
+		blob, err := newBlobStore(dirpath).store(absoluteFilep, sum, ctx)
+		if err != nil {
+			return deviation, false
+		}
+		deviation.Blob = blob
+	}
+	relativeFilep, err := filepath.Rel(dirpath, absoluteFilep)
+	if err != nil {
+		shared.Logger.Error("Failed to derive relative filepath.", "error", err)
+		return deviation, false
+	}
+	// The extension may have been corrected.
+	if relativeFilep != deviation.Filename {
+		oldFilep := filepath.Join(dirpath, deviation.Filename)
+		if exists, _ := ctx.Fsys().Exists(oldFilep); exists {
+			if err := ctx.Fsys().Remove(oldFilep); err != nil {
+				shared.Logger.Warn("Failed to remove file.", "filepath", oldFilep, "error", err)
+			}
+		}
+	}
+	deviation.RssItem = item
+	deviation.Filename = relativeFilep
+	deviation.Size = size
+	deviation.SHA256 = sum
+	deviation.Image = imageInfo
+	return deviation, true
+}
+
+// Download item into the directory of filename, e.g. "Collection/<uuid>/image.jpg". Literature is
+// saved anew from its text, or from its description if the manifest predates recording the text.
+// Return the downloaded file's filepath or empty on failure.
+func redownloadItem(
+	dirpath, filename string,
+	item djson.RssItem,
+	ctx Context,
+) (string, *djson.ImageInfo) {
+	uuidDirpath := filepath.Dir(filepath.Join(dirpath, filename))
+	if item.Medium == MediumLiterature && item.URL == "" {
+		item.Text = firstNonEmpty(item.Text, item.DescriptionMarkdown)
+		if item.Text == "" {
+			return "", nil
+		}
+		return saveLiterature(uuidDirpath, item, ctx), nil
+	}
+	if item.URL == "" {
+		return "", nil
+	}
+	return downloadImages(
+		downloadParams{
+			dirname:    filepath.Dir(uuidDirpath),
+			url:        item.URL,
+			uuid:       filepath.Base(uuidDirpath),
+			filename:   deriveFilename("", item.URL),
+			medium:     item.Medium,
+			dimensions: item.Dimensions,
+		},
+		ctx)
+}
@@ -0,0 +1,186 @@
+package dafavorites
+
+import (
+	"path/filepath"
+	"testing"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepair(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: newTestHTTPClient(),
+	}
+	req := require.New(t)
+	kat := fixtureBytes(t, katImageURL)
+	ok := createSavedDeviation(filepath.Join("1", "kat.jpg"), katImageURL, kat)
+	writeArchiveFile(req, fsys, dirp, ok.Filename, kat)
+	missing := createSavedDeviation(filepath.Join("2", "anna.jpg"), annaImageURL, kat)
+	missing.AuthorAvatar = filepath.Join("authors", "WojtekFus.jpg")
+	missing.RssItem.Author = "WojtekFus"
+	missing.RssItem.AuthorAvatarURL = "https://a.deviantart.net/avatars/w/o/wojtekfus.jpg?5"
+	changed := createSavedDeviation(filepath.Join("3", "kat.jpg"), katImageURL, kat)
+	writeArchiveFile(req, fsys, dirp, changed.Filename, []byte("bit rot"))
+	expired := createSavedDeviation(
+		filepath.Join("4", "kat.jpg"),
+		"https://images-wixmp.com/expired.jpg",
+		kat)
+	expired.RssItem.Link = "https://www.deviantart.com/friesellfly/art/Kat-1042398875"
+	corrupt := createSavedDeviation(filepath.Join("5", "png.jpg"), pngImageURL, nil)
+	writeArchiveFile(req, fsys, dirp, corrupt.Filename, kat[:100])
+	lost := createSavedDeviation(
+		filepath.Join("6", "lost.jpg"),
+		"https://images-wixmp.com/lost.jpg",
+		kat)
+	deviantFetch := djson.DeviantFetch{
+		SavedDeviations: []djson.SavedDeviation{ok, missing, changed, expired, corrupt, lost},
+	}
+
+	// EXERCISE
+	repaired, report, err := Repair(dirp, deviantFetch, ctx)
+
+	// VERIFY
+	req.Nil(err)
+	req.Equal(
+		RepairReport{
+			Repaired: []string{
+				filepath.Join("2", "anna.jpg"),
+				filepath.Join("3", "kat.jpg"),
+				filepath.Join("4", "kat.jpg"),
+				filepath.Join("5", "png.png"),
+			},
+			Failed: []string{filepath.Join("6", "lost.jpg")},
+		},
+		report)
+	deviations := repaired.SavedDeviations
+	req.Equal(ok, deviations[0])
+	req.Equal(sha256Hex(string(fixtureBytes(t, annaImageURL))), deviations[1].SHA256)
+	req.Equal(missing.AuthorAvatar, deviations[1].AuthorAvatar)
+	req.Equal(katImageURL, deviations[3].RssItem.URL, "URL should be resolved anew.")
+	req.Equal(&djson.ImageInfo{Width: 2, Height: 2, Format: "png"}, deviations[4].Image)
+	req.Equal(lost, deviations[5])
+	req.Equal(
+		expired.Filename,
+		deviantFetch.SavedDeviations[3].Filename,
+		"Original shouldn't be modified.")
+	req.Equal("https://images-wixmp.com/expired.jpg", deviantFetch.SavedDeviations[3].RssItem.URL)
+
+	verifyReport, err := Verify(dirp, repaired, nil, ctx)
+	req.Nil(err)
+	req.Equal(
+		VerifyReport{Missing: []string{filepath.Join("6", "lost.jpg")}, Verified: 5},
+		verifyReport)
+}
+
+func TestRepairPreviousVersions(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: newTestHTTPClient(),
+	}
+	req := require.New(t)
+	kat := fixtureBytes(t, katImageURL)
+	anna := fixtureBytes(t, annaImageURL)
+	current := filepath.Join("new", "kat.jpg")
+	writeArchiveFile(req, fsys, dirp, current, kat)
+	deviation := djson.SavedDeviation{
+		RssItem: djson.RssItem{
+			GUID:   "kat",
+			Link:   "https://www.deviantart.com/friesellfly/art/Kat-1042398875",
+			URL:    katImageURL,
+			Medium: MediumImage,
+		},
+		Filename: current,
+		Size:     int64(len(kat)),
+		SHA256:   sha256Hex(string(kat)),
+		PreviousVersions: []djson.PreviousVersion{
+			{
+				Filename: filepath.Join("old", "anna.jpg"),
+				Size:     int64(len(anna)),
+				SHA256:   sha256Hex(string(anna)),
+				URL:      annaImageURL,
+			},
+			{
+				Filename: filepath.Join("older", "expired.jpg"),
+				Size:     3,
+				SHA256:   sha256Hex("old"),
+				URL:      "https://images-wixmp.com/expired.jpg",
+			},
+		},
+	}
+	deviantFetch := djson.DeviantFetch{SavedDeviations: []djson.SavedDeviation{deviation}}
+
+	// EXERCISE
+	repaired, report, err := Repair(dirp, deviantFetch, ctx)
+
+	// VERIFY
+	req.Nil(err)
+	req.Equal(
+		RepairReport{
+			Repaired: []string{filepath.Join("old", "anna.jpg")},
+			Failed:   []string{filepath.Join("older", "expired.jpg")},
+		},
+		report)
+	verifyFileContent(req, fsys, dirp, "anna.jpg", anna)
+	versions := repaired.SavedDeviations[0].PreviousVersions
+	req.Equal(sha256Hex(string(anna)), versions[0].SHA256)
+	req.Equal(
+		&djson.ImageInfo{Width: 2, Height: 2, Format: "jpeg"},
+		versions[0].Image)
+	req.Nil(deviation.PreviousVersions[0].Image, "Original shouldn't be modified.")
+	req.Equal(current, repaired.SavedDeviations[0].Filename)
+}
+
+func TestRepairLiterature(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: newTestHTTPClient(),
+	}
+	req := require.New(t)
+	content := "# Poem\n\nRoses are **red**\n"
+	poem := djson.SavedDeviation{
+		RssItem: djson.RssItem{
+			GUID:   "poem",
+			Title:  "Poem",
+			Link:   "https://www.deviantart.com/friesellfly/art/Kat-1042398875",
+			Medium: MediumLiterature,
+			Text:   "Roses are **red**",
+		},
+		Filename: filepath.Join("1", "Poem.md"),
+		Size:     int64(len(content)),
+		SHA256:   sha256Hex(content),
+	}
+	// Manifests written before the text was recorded have only the description.
+	old := poem
+	old.RssItem.GUID = "old"
+	old.RssItem.Text = ""
+	old.RssItem.DescriptionMarkdown = "Roses are **red**"
+	old.Filename = filepath.Join("2", "Poem.md")
+	writeArchiveFile(req, fsys, dirp, old.Filename, []byte("bit rot"))
+	deviantFetch := djson.DeviantFetch{SavedDeviations: []djson.SavedDeviation{poem, old}}
+
+	// EXERCISE
+	repaired, report, err := Repair(dirp, deviantFetch, ctx)
+
+	// VERIFY
+	req.Nil(err)
+	req.Equal(RepairReport{Repaired: []string{poem.Filename, old.Filename}}, report)
+	req.Equal(deviantFetch.SavedDeviations, repaired.SavedDeviations)
+	for _, each := range []string{poem.Filename, old.Filename} {
+		actual, err := fsys.ReadFile(filepath.Join(dirp, each))
+		req.Nil(err)
+		req.Equal(content, string(actual))
+	}
+}
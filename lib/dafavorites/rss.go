@@ -0,0 +1,158 @@
+package dafavorites
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	dxml "github.com/denarced/dafavorites/lib/dafavorites/xml"
+	"github.com/denarced/dafavorites/shared/shared"
+)
+
+var (
+	// A single <item> element. Items are decoded one by one so that a broken
+	// item doesn't prevent decoding the rest.
+	itemPattern = regexp.MustCompile(`(?s)<item[\s>].*?</item\s*>`)
+	// A single Atom <entry> element, decoded one by one like items.
+	entryPattern = regexp.MustCompile(`(?s)<entry[\s>].*?</entry\s*>`)
+	// The start tag of the root element, e.g. <rss version="2.0" ...>.
+	rootPattern = regexp.MustCompile(`<(?:rss|feed|rdf:RDF)[\s>][^>]*>`)
+	// A namespace declaration, e.g. xmlns:media="http://search.yahoo.com/mrss/".
+	namespacePattern = regexp.MustCompile(`xmlns(?::[\w.-]+)?\s*=\s*("[^"]*"|'[^']*')`)
+)
+
+// Decode RSS leniently. Invalid characters are dropped, HTML entities are
+// accepted and each item is decoded separately: items that fail to decode are
+// logged and skipped. An error is returned only if the channel itself can't be
+// decoded.
+func decodeRss(contentBytes []byte) (dxml.RssElement, error) {
+	rssElement := dxml.RssElement{}
+	err := decodeLeniently(contentBytes, itemPattern, &rssElement, func(decoder *xml.Decoder) error {
+		wrapper := struct {
+			Items []dxml.RssItemElement `xml:"item"`
+		}{}
+		if err := decoder.Decode(&wrapper); err != nil {
+			return err
+		}
+		rssElement.Channel.RssItems = append(rssElement.Channel.RssItems, wrapper.Items...)
+		return nil
+	})
+	return rssElement, err
+}
+
+// Decode contentBytes leniently into root. The elements that match pattern are
+// removed from the document before decoding it and instead each of them is
+// decoded separately with decodeElement from a document of its own. Elements
+// that fail to decode are logged and skipped.
+func decodeLeniently(
+	contentBytes []byte,
+	pattern *regexp.Regexp,
+	root interface{},
+	decodeElement func(*xml.Decoder) error,
+) error {
+	sanitized := sanitizeXML(contentBytes)
+	withoutElements := pattern.ReplaceAll(sanitized, nil)
+	if err := newLenientDecoder(withoutElements).Decode(root); err != nil {
+		shared.Logger.Error("Failed to unmarshal XML.", "error", err)
+		return err
+	}
+
+	wrapperStart, wrapperEnd := deriveElementWrapper(sanitized)
+	for i, each := range pattern.FindAll(sanitized, -1) {
+		wrapped := make([]byte, 0, len(wrapperStart)+len(each)+len(wrapperEnd))
+		wrapped = append(wrapped, wrapperStart...)
+		wrapped = append(wrapped, each...)
+		wrapped = append(wrapped, wrapperEnd...)
+		if err := decodeElement(newLenientDecoder(wrapped)); err != nil {
+			shared.Logger.Error(
+				"Failed to unmarshal XML element, skipping it.",
+				"index",
+				i,
+				"error",
+				err)
+		}
+	}
+	return nil
+}
+
+func newLenientDecoder(contentBytes []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(contentBytes))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	decoder.CharsetReader = newCharsetReader
+	return decoder
+}
+
+// Derive the start and end tags of an element that wraps a single element,
+// e.g. an item. The start tag declares the same namespaces as the document's
+// root element so that prefixes like "media:" resolve correctly.
+func deriveElementWrapper(document []byte) (string, string) {
+	declarations := namespacePattern.FindAllString(string(rootPattern.Find(document)), -1)
+	return "<wrapper " + strings.Join(declarations, " ") + ">", "</wrapper>"
+}
+
+// Drop characters that aren't allowed in XML, e.g. control characters, and
+// replace invalid UTF-8 with the replacement character.
+func sanitizeXML(contentBytes []byte) []byte {
+	sanitized := make([]byte, 0, len(contentBytes))
+	for len(contentBytes) > 0 {
+		r, size := utf8.DecodeRune(contentBytes)
+		contentBytes = contentBytes[size:]
+		if r == utf8.RuneError && size == 1 {
+			sanitized = utf8.AppendRune(sanitized, utf8.RuneError)
+			continue
+		}
+		if isValidXMLChar(r) {
+			sanitized = append(sanitized, string(r)...)
+		}
+	}
+	return sanitized
+}
+
+func isValidXMLChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		(r >= 0x20 && r <= 0xD7FF) ||
+		(r >= 0xE000 && r <= 0xFFFD) ||
+		(r >= 0x10000 && r <= 0x10FFFF)
+}
+
+// Read any declared charset as is. The content has been sanitized into valid
+// UTF-8 already so a charset declaration mustn't fail the whole document.
+func newCharsetReader(_ string, input io.Reader) (io.Reader, error) {
+	return input, nil
+}
+
+// Pick the content element of the item to download. Originals that aren't
+// images, e.g. videos, are preferred over images, which are then likely only
+// previews. After that a default or the largest version is preferred.
+func pickContent(
+	contents []dxml.ItemContentElement,
+	groups []dxml.ItemGroupElement,
+) dxml.ItemContentElement {
+	candidates := append([]dxml.ItemContentElement(nil), contents...)
+	for _, each := range groups {
+		candidates = append(candidates, each.Contents...)
+	}
+	hasOriginal := false
+	for _, each := range candidates {
+		if each.URL != "" && deriveMedium(each) != MediumImage {
+			hasOriginal = true
+		}
+	}
+	var picked dxml.ItemContentElement
+	for _, each := range candidates {
+		if each.URL == "" || (hasOriginal && deriveMedium(each) == MediumImage) {
+			continue
+		}
+		if each.IsDefault == "true" {
+			return each
+		}
+		if picked.URL == "" || each.Width*each.Height > picked.Width*picked.Height {
+			picked = each
+		}
+	}
+	return picked
+}
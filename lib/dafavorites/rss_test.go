@@ -0,0 +1,69 @@
+package dafavorites
+
+import (
+	"testing"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToRssFileLenient(t *testing.T) {
+	shared.InitTestLogging(t)
+	content := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n" +
+		`<rss version="2.0" xmlns:media="http://search.yahoo.com/mrss/"
+			xmlns:atom="http://www.w3.org/2005/Atom"
+			xmlns:creativeCommons="http://backend.userland.com/creativeCommonsRssModule">
+		<channel>
+			<link>https://www.deviantart.com/</link>
+			<atom:link rel="self" href="https://backend.deviantart.com/rss.xml?offset=0"/>
+			<atom:link rel="next" href="https://backend.deviantart.com/rss.xml?offset=60"/>
+			<item>
+				<title>Tom &amp; Jerry&nbsp;` + "\x0b" + `</title>
+				<media:title>Media title</media:title>
+				<link>https://www.deviantart.com/a/art/Tom-1</link>
+				<media:credit role="author">a</media:credit>
+				<media:group>
+					<media:content url="https://a/small.jpg" width="10" height="10"/>
+					<media:content url="https://a/large.jpg" width="20" height="20"/>
+				</media:group>
+			</item>
+			<item>
+				<title>Broken <<</title>
+			</item>
+			<item>
+				<media:title>Only media title</media:title>
+				<link>https://www.deviantart.com/b/art/Only-2</link>
+				<media:content url="https://b/small.jpg" width="10" height="10"/>
+				<media:content url="https://b/default.jpg" width="5" height="5" isDefault="true"/>
+			</item>
+		</channel>
+	</rss>`
+
+	// EXERCISE
+	rssFile, err := toRssFile([]byte(content))
+
+	// VERIFY
+	req := require.New(t)
+	req.Nil(err)
+	req.Equal("https://backend.deviantart.com/rss.xml?offset=60", rssFile.nextURL)
+	req.Equal(
+		[]djson.RssItem{
+			{
+				Title:      "Tom & Jerry\u00a0",
+				Link:       "https://www.deviantart.com/a/art/Tom-1",
+				Author:     "a",
+				URL:        "https://a/large.jpg",
+				Dimensions: djson.Dimensions{Width: 20, Height: 20},
+				Medium:     MediumImage,
+			},
+			{
+				Title:      "Only media title",
+				Link:       "https://www.deviantart.com/b/art/Only-2",
+				URL:        "https://b/default.jpg",
+				Dimensions: djson.Dimensions{Width: 5, Height: 5},
+				Medium:     MediumImage,
+			},
+		},
+		rssFile.rssItems)
+}
@@ -0,0 +1,121 @@
+package dafavorites
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	mimeTypeUnknown = "application/octet-stream"
+	mimeTypeFlash   = "application/x-shockwave-flash"
+)
+
+// The extension of each sniffed MIME type.
+var mimeTypeExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/bmp":       ".bmp",
+	"image/x-icon":    ".ico",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"video/avi":       ".avi",
+	"audio/mpeg":      ".mp3",
+	"audio/wave":      ".wav",
+	"audio/aiff":      ".aiff",
+	"audio/midi":      ".mid",
+	"application/ogg": ".ogg",
+	"application/pdf": ".pdf",
+	mimeTypeFlash:     ".swf",
+}
+
+// Extensions that are as good as the key, which is the one in mimeTypeExtensions.
+var extensionAliases = map[string][]string{
+	".jpg":  {".jpeg", ".jpe", ".jfif"},
+	".mp4":  {".m4v", ".mov"},
+	".mid":  {".midi"},
+	".aiff": {".aif"},
+}
+
+// Verify that response is a complete download of medium, e.g. an image and not an HTML error
+// page. The MIME type is sniffed from the magic bytes and header Content-Type is only trusted
+// when the magic bytes aren't recognised. Return the extension of the sniffed type, e.g. ".webp",
+// or empty when it isn't known.
+func verifyDownload(response Response, medium string) (string, error) {
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return "", fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+	if len(response.Body) == 0 {
+		return "", fmt.Errorf("empty response")
+	}
+	if response.ContentLength >= 0 && int64(len(response.Body)) != response.ContentLength {
+		return "", fmt.Errorf(
+			"truncated response, %d bytes of %d",
+			len(response.Body),
+			response.ContentLength)
+	}
+	sniffed := sniffMimeType(response.Body)
+	if matchesMedium(sniffed, medium) {
+		return mimeTypeExtensions[sniffed], nil
+	}
+	declared, _, _ := mime.ParseMediaType(response.ContentType)
+	if sniffed == mimeTypeUnknown && matchesMedium(declared, medium) {
+		return "", nil
+	}
+	if medium == "" {
+		medium = MediumImage
+	}
+	return "", fmt.Errorf(
+		"expected %s but got %s with Content-Type %q",
+		medium,
+		sniffed,
+		response.ContentType)
+}
+
+// Sniff the MIME type of content from its magic bytes, e.g. "image/jpeg".
+func sniffMimeType(content []byte) string {
+	// Not known by http.DetectContentType: uncompressed, zlib and LZMA compressed Flash.
+	for _, each := range []string{"FWS", "CWS", "ZWS"} {
+		if bytes.HasPrefix(content, []byte(each)) {
+			return mimeTypeFlash
+		}
+	}
+	mimeType, _, _ := mime.ParseMediaType(http.DetectContentType(content))
+	return mimeType
+}
+
+// Tell whether mimeType is of medium. Empty medium is taken as an image.
+func matchesMedium(mimeType, medium string) bool {
+	switch medium {
+	case MediumVideo:
+		return strings.HasPrefix(mimeType, "video/") || mimeType == "application/ogg"
+	case MediumAudio:
+		return strings.HasPrefix(mimeType, "audio/") || mimeType == "application/ogg"
+	case MediumDocument:
+		return mimeType == "application/pdf"
+	case MediumFlash:
+		return mimeType == mimeTypeFlash
+	}
+	return strings.HasPrefix(mimeType, "image/")
+}
+
+// Replace the extension of filename with extension unless they already match. Empty extension
+// keeps filename as is.
+func correctExtension(filename, extension string) string {
+	current := filepath.Ext(filename)
+	lower := strings.ToLower(current)
+	if extension == "" || lower == extension {
+		return filename
+	}
+	for _, each := range extensionAliases[extension] {
+		if lower == each {
+			return filename
+		}
+	}
+	return strings.TrimSuffix(filename, current) + extension
+}
@@ -0,0 +1,101 @@
+package dafavorites
+
+import (
+	"net/http"
+	"testing"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+const pngImageURL = "https://images-wixmp.com/png.jpg"
+
+func TestVerifyDownload(t *testing.T) {
+	jpeg := fixtureBytes(t, katImageURL)
+	run := func(name string, response Response, medium, expected string, expectedErr bool) {
+		t.Run(name, func(t *testing.T) {
+			if response.StatusCode == 0 {
+				response.StatusCode = http.StatusOK
+			}
+			if response.ContentLength == 0 {
+				response.ContentLength = int64(len(response.Body))
+			}
+			extension, err := verifyDownload(response, medium)
+			req := require.New(t)
+			req.Equal(expectedErr, err != nil, "%v", err)
+			req.Equal(expected, extension)
+		})
+	}
+
+	run("JPEG", Response{Body: jpeg}, MediumImage, ".jpg", false)
+	run("No medium", Response{Body: jpeg}, "", ".jpg", false)
+	run("PNG", Response{Body: fixtureBytes(t, pngImageURL)}, "", ".png", false)
+	run(
+		"HTML",
+		Response{Body: []byte("<html><body>Error</body></html>"), ContentType: "image/jpeg"},
+		MediumImage,
+		"",
+		true)
+	run("Not found", Response{Body: jpeg, StatusCode: http.StatusNotFound}, MediumImage, "", true)
+	run("Empty", Response{ContentLength: -1}, MediumImage, "", true)
+	run("Truncated", Response{Body: jpeg[:100], ContentLength: int64(len(jpeg))}, "", "", true)
+	run("Unknown length", Response{Body: jpeg, ContentLength: -1}, "", ".jpg", false)
+	run("Image as video", Response{Body: jpeg}, MediumVideo, "", true)
+	run("PDF", Response{Body: []byte("%PDF-1.4\n...")}, MediumDocument, ".pdf", false)
+	run("Flash", Response{Body: []byte("CWS\x0a....")}, MediumFlash, ".swf", false)
+	run(
+		"Declared video",
+		Response{Body: []byte{0, 0, 0, 1, 2, 3}, ContentType: "video/x-matroska"},
+		MediumVideo,
+		"",
+		false)
+	run(
+		"Unknown image",
+		Response{Body: []byte{0, 0, 0, 1, 2, 3}, ContentType: "text/plain"},
+		MediumImage,
+		"",
+		true)
+}
+
+func TestCorrectExtension(t *testing.T) {
+	run := func(filename, extension, expected string) {
+		t.Run(filename+extension, func(t *testing.T) {
+			require.Equal(t, expected, correctExtension(filename, extension))
+		})
+	}
+
+	run("a.jpg", ".jpg", "a.jpg")
+	run("a.JPEG", ".jpg", "a.JPEG")
+	run("a.jpg", ".webp", "a.webp")
+	run("a", ".png", "a.png")
+	run("a.jpg", "", "a.jpg")
+}
+
+func TestFetchVerifiesDownloads(t *testing.T) {
+	shared.InitTestLogging(t)
+	dirp := "/root"
+	fsys := &afero.Afero{Fs: afero.NewMemMapFs()}
+	ctx := &TestContext{
+		fsys:       fsys,
+		httpClient: newTestHTTPClient(),
+	}
+	source := &testSource{
+		pages: [][]djson.RssItem{{
+			{GUID: "png", URL: pngImageURL, Medium: MediumImage},
+			{GUID: "error", URL: "https://images-wixmp.com/error.jpg", Medium: MediumImage},
+		}},
+		origin: djson.Origin{Kind: SourceFavorites, Username: "denarced"},
+	}
+
+	// EXERCISE
+	fetched := Fetch([]Source{source}, Options{Dirpath: dirp, WorkerCount: 1}, ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Equal(1, len(fetched.SavedDeviations), "HTML should be rejected.")
+	req.Equal("png", fetched.SavedDeviations[0].RssItem.GUID)
+	req.Regexp(`/png\.png$`, fetched.SavedDeviations[0].Filename)
+	verifyFileContent(req, fsys, dirp, "png.png", fixtureBytes(t, pngImageURL))
+}
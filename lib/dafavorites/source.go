@@ -0,0 +1,198 @@
+package dafavorites
+
+import (
+	"io"
+	"net/url"
+	"strconv"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+)
+
+const (
+	// SourceFavorites is the origin kind of deviations from user's favorites.
+	SourceFavorites = "favorites"
+	// SourceGallery is the origin kind of deviations from user's own gallery.
+	SourceGallery = "gallery"
+	// SourceSearch is the origin kind of deviations found with a search query.
+	SourceSearch = "search"
+)
+
+// Source provides the deviations to be downloaded one page at a time. It hides where the items
+// come from, e.g. a user's favorites, a gallery or a list of URLs.
+type Source interface {
+	// Next returns the next page of items. Once there are no more pages, io.EOF is returned.
+	Next(ctx Context) ([]djson.RssItem, error)
+	// Origin describes the source. It's recorded for each deviation the source provides.
+	Origin() djson.Origin
+}
+
+// A Source that can tell whether it has pages left without fetching the next one.
+type endAwareSource interface {
+	// HasNext tells whether Next would return another page instead of io.EOF.
+	hasNext() bool
+}
+
+// Tell whether source has pages left. Sources that can't tell are assumed to have.
+func hasNextPage(source Source) bool {
+	if aware, ok := source.(endAwareSource); ok {
+		return aware.hasNext()
+	}
+	return true
+}
+
+// RssSource reads Deviant Art RSS files and follows their "next" links.
+type rssSource struct {
+	// The URL of the next RSS file to fetch, empty when there are no more.
+	nextURL string
+	origin  djson.Origin
+	// Parses a single fetched file.
+	parse func([]byte) (rssFile, error)
+	// Normalized URLs of the RSS files read so far.
+	visited map[string]bool
+	// The offset of the last RSS file read, -1 before the first one with an
+	// offset.
+	offset int
+}
+
+// NewRssSource creates a Source that starts from the RSS file in url and follows the "next"
+// links until there are no more. Each deviation is recorded to have come from origin. If a "next"
+// link points to an RSS file that has been read already or to an earlier offset,
+// ErrPaginationCycle is returned instead of following it.
+func NewRssSource(url string, origin djson.Origin) Source {
+	return newPagedSource(url, origin, toRssFile)
+}
+
+func newPagedSource(url string, origin djson.Origin, parse func([]byte) (rssFile, error)) Source {
+	return &rssSource{
+		nextURL: url,
+		origin:  origin,
+		parse:   parse,
+		visited: map[string]bool{},
+		offset:  -1,
+	}
+}
+
+// NewFavoritesSource creates a Source for user username's favorite deviations.
+func NewFavoritesSource(username string) Source {
+	return NewRssSource(
+		buildRssURL("favby:"+username),
+		djson.Origin{Kind: SourceFavorites, Username: username})
+}
+
+// NewGallerySource creates a Source for the deviations in user username's gallery, i.e. their
+// own uploads.
+func NewGallerySource(username string) Source {
+	return NewRssSource(
+		buildRssURL("gallery:"+username),
+		djson.Origin{Kind: SourceGallery, Username: username})
+}
+
+// NewSearchSource creates a Source for the results of search query, e.g. "tag:landscape" or
+// "in:digitalart/paintings sort:time". Anything the RSS backend accepts in parameter "q" goes.
+func NewSearchSource(query string) Source {
+	return NewRssSource(buildRssURL(query), djson.Origin{Kind: SourceSearch, Query: query})
+}
+
+func (v *rssSource) Next(ctx Context) ([]djson.RssItem, error) {
+	if len(v.nextURL) == 0 {
+		return nil, io.EOF
+	}
+	normalized, offset := normalizeRssURL(v.nextURL)
+	if v.visited[normalized] || (offset >= 0 && offset <= v.offset) {
+		shared.Logger.Error(
+			"Pagination cycle detected.",
+			"url",
+			v.nextURL,
+			"offset",
+			offset,
+			"previous offset",
+			v.offset)
+		return nil, ErrPaginationCycle
+	}
+	contentBytes, err := fetchRssFile(v.nextURL, ctx)
+	if err != nil {
+		return nil, err
+	}
+	rssFile, err := v.parse(contentBytes)
+	if err != nil {
+		return nil, err
+	}
+	v.visited[normalized] = true
+	if offset >= 0 {
+		v.offset = offset
+	}
+	v.nextURL = rssFile.nextURL
+	return rssFile.rssItems, nil
+}
+
+func (v *rssSource) Origin() djson.Origin {
+	return v.origin
+}
+
+func (v *rssSource) hasNext() bool {
+	return len(v.nextURL) > 0
+}
+
+// Normalize rawURL so that the same RSS file has always the same URL regardless of the scheme or
+// the order of query parameters. Return also the URL's offset, -1 when it has none.
+func normalizeRssURL(rawURL string) (string, int) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL, -1
+	}
+	query := parsed.Query()
+	offset, err := strconv.Atoi(query.Get("offset"))
+	if err != nil {
+		offset = -1
+	}
+	return parsed.Host + parsed.Path + "?" + query.Encode(), offset
+}
+
+// Build the URL of the first RSS file for search query, e.g. "favby:username".
+func buildRssURL(query string) string {
+	return baseRss + "?q=" + url.QueryEscape(query) + "&type=deviation"
+}
+
+// LimitedSource provides at most maxItems items of another source.
+type limitedSource struct {
+	source   Source
+	maxItems int
+	count    int
+	// True once items have been left out.
+	truncated bool
+}
+
+// NewLimitedSource creates a Source that provides at most maxItems items from source. After that
+// ErrLimitReached is returned if source has more items and io.EOF if it doesn't.
+func NewLimitedSource(source Source, maxItems int) Source {
+	return &limitedSource{source: source, maxItems: maxItems}
+}
+
+func (v *limitedSource) Next(ctx Context) ([]djson.RssItem, error) {
+	if v.count >= v.maxItems {
+		if !v.hasNext() {
+			return nil, io.EOF
+		}
+		shared.Logger.Info("Item limit reached.", "limit", v.maxItems)
+		return nil, ErrLimitReached
+	}
+	items, err := v.source.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if remaining := v.maxItems - v.count; len(items) > remaining {
+		items = items[:remaining]
+		v.truncated = true
+	}
+	v.count += len(items)
+	return items, nil
+}
+
+func (v *limitedSource) hasNext() bool {
+	return v.truncated || hasNextPage(v.source)
+}
+
+func (v *limitedSource) Origin() djson.Origin {
+	return v.source.Origin()
+}
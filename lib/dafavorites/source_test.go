@@ -0,0 +1,157 @@
+package dafavorites
+
+import (
+	"io"
+	"testing"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildRssURL(t *testing.T) {
+	shared.InitTestLogging(t)
+	assert.Equal(
+		t,
+		"http://backend.deviantart.com/rss.xml?q=tag%3Acat+by%3Adenarced&type=deviation",
+		buildRssURL("tag:cat by:denarced"))
+}
+
+func TestLimitedSource(t *testing.T) {
+	shared.InitTestLogging(t)
+	item := djson.RssItem{Title: "Kat"}
+	origin := djson.Origin{Kind: SourceSearch, Query: "tag:cat"}
+	limited := &testSource{
+		pages:  [][]djson.RssItem{{item, item}, {item, item}, {item}},
+		origin: origin,
+	}
+	source := NewLimitedSource(limited, 3)
+
+	// EXERCISE & VERIFY
+	ass := assert.New(t)
+	items, err := source.Next(nil)
+	ass.Nil(err)
+	ass.Equal(2, len(items))
+	items, err = source.Next(nil)
+	ass.Nil(err)
+	ass.Equal(1, len(items), "Page should be cut at the limit.")
+	_, err = source.Next(nil)
+	ass.Equal(ErrLimitReached, err)
+	ass.Equal(2, limited.calls, "Nothing should be fetched past the limit.")
+	ass.Equal(origin, source.Origin())
+}
+
+func TestLimitedSourceEndsAtLimit(t *testing.T) {
+	shared.InitTestLogging(t)
+	item := djson.RssItem{Title: "Kat"}
+	source := NewLimitedSource(&testSource{pages: [][]djson.RssItem{{item, item}}}, 2)
+
+	// EXERCISE & VERIFY
+	ass := assert.New(t)
+	items, err := source.Next(nil)
+	ass.Nil(err)
+	ass.Equal(2, len(items))
+	_, err = source.Next(nil)
+	ass.Equal(io.EOF, err, "Source ended exactly at the limit.")
+}
+
+func TestFetchStopsOnPaginationCycle(t *testing.T) {
+	shared.InitTestLogging(t)
+	httpClient := newTestHTTPClient()
+	ctx := &TestContext{
+		fsys:       &afero.Afero{Fs: afero.NewMemMapFs()},
+		httpClient: httpClient,
+	}
+
+	// EXERCISE
+	fetched := Fetch(
+		[]Source{NewFavoritesSource("cycle")},
+		Options{Dirpath: "/root", WorkerCount: 1},
+		ctx)
+
+	// VERIFY
+	ass := assert.New(t)
+	ass.Nil(httpClient.err)
+	ass.Equal(2, len(fetched.SavedDeviations))
+	ass.Equal(
+		[]djson.Listing{{
+			Origin: djson.Origin{Kind: SourceFavorites, Username: "cycle"},
+			Reason: TruncatedCycle,
+			Pages:  2,
+			Items:  2,
+		}},
+		fetched.Listings)
+}
+
+func TestFetchLimits(t *testing.T) {
+	run := func(name string, options Options, expected djson.Listing) {
+		t.Run(name, func(t *testing.T) {
+			shared.InitTestLogging(t)
+			ctx := &TestContext{
+				fsys:       &afero.Afero{Fs: afero.NewMemMapFs()},
+				httpClient: newTestHTTPClient(),
+			}
+			options.Dirpath = "/root"
+			options.WorkerCount = 1
+
+			// EXERCISE
+			fetched := Fetch([]Source{NewFavoritesSource("denarced")}, options, ctx)
+
+			// VERIFY
+			expected.Origin = djson.Origin{Kind: SourceFavorites, Username: "denarced"}
+			assert.Equal(t, []djson.Listing{expected}, fetched.Listings)
+			assert.Equal(t, expected.Items, len(fetched.SavedDeviations))
+		})
+	}
+
+	run("No limits", Options{}, djson.Listing{Complete: true, Pages: 2, Items: 2})
+	run(
+		"Max pages",
+		Options{MaxPages: 1},
+		djson.Listing{Reason: TruncatedMaxPages, Pages: 1, Items: 1})
+	run(
+		"Max items",
+		Options{MaxItems: 1},
+		djson.Listing{Reason: TruncatedMaxItems, Pages: 1, Items: 1})
+	run(
+		"Ends at max pages",
+		Options{MaxPages: 2},
+		djson.Listing{Complete: true, Pages: 2, Items: 2})
+	run(
+		"Ends at max items",
+		Options{MaxItems: 2},
+		djson.Listing{Complete: true, Pages: 2, Items: 2})
+}
+
+func TestFetchLimitsDontFetchPastLimit(t *testing.T) {
+	item := djson.RssItem{GUID: "kat", Title: "Kat", URL: katImageURL}
+	origin := djson.Origin{Kind: SourceFavorites, Username: "david"}
+	run := func(name string, pages [][]djson.RssItem, expected djson.Listing) {
+		t.Run(name, func(t *testing.T) {
+			shared.InitTestLogging(t)
+			ctx := &TestContext{
+				fsys:       &afero.Afero{Fs: afero.NewMemMapFs()},
+				httpClient: newTestHTTPClient(),
+			}
+			source := &testSource{pages: pages, origin: origin}
+
+			// EXERCISE
+			fetched := Fetch(
+				[]Source{source},
+				Options{Dirpath: "/root", WorkerCount: 1, MaxPages: 1},
+				ctx)
+
+			// VERIFY
+			expected.Origin = origin
+			assert.Equal(t, []djson.Listing{expected}, fetched.Listings)
+			assert.Equal(t, 1, source.calls)
+		})
+	}
+
+	run(
+		"More pages",
+		[][]djson.RssItem{{item}, {item}},
+		djson.Listing{Reason: TruncatedMaxPages, Pages: 1, Items: 1})
+	run("Last page", [][]djson.RssItem{{item}}, djson.Listing{Complete: true, Pages: 1, Items: 1})
+}
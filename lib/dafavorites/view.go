@@ -0,0 +1,345 @@
+package dafavorites
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+)
+
+// The directory under the archive's root for views.
+const viewsDirname = "views"
+
+// The group of deviations that have no value for the view's field.
+const unknownViewValue = "unknown"
+
+// ViewFields are the named fields that a view can group deviations by. Any other field of the
+// manifest can be given by its path, see BuildView.
+var ViewFields = []string{
+	"author",
+	"year",
+	"category",
+	"medium",
+	"license",
+	"rating",
+	"collection",
+	"favoritedby",
+}
+
+// ViewReport tells how BuildView changed a view.
+type ViewReport struct {
+	Created int
+	Kept    int
+	Removed int
+}
+
+// BuildView builds directory "views/<field>" in archive dirpath with a link to each deviation's
+// file in a sub directory named after the deviation's value of field, e.g.
+// "views/author/WojtekFus/anna.jpg". Categories are nested, e.g. "views/category/digitalart/...".
+// Deviations with several values, e.g. in several collections, are linked from each of them.
+// Besides ViewFields, field can be the path of any field of a deviation in the manifest, e.g.
+// "RemovedReason", "Origins.Kind" or "RssItem.Title". Names are case-insensitive and "RssItem."
+// can be left out. Times are grouped by date.
+//
+// Links are relative symbolic links unless hardlink is true. The view is built incrementally:
+// links that are right already are kept and links that deviantFetch no longer has are removed.
+func BuildView(
+	dirpath string,
+	deviantFetch djson.DeviantFetch,
+	field string,
+	hardlink bool,
+	ctx Context,
+) (ViewReport, error) {
+	if !slices.Contains(ViewFields, field) && !isViewFieldPath(field) {
+		return ViewReport{}, fmt.Errorf("unknown view field %q", field)
+	}
+	if _, ok := ctx.Fsys().Fs.(*afero.OsFs); hardlink && !ok {
+		return ViewReport{}, errors.New("hard links are only supported on the OS file system")
+	}
+	viewDirpath := filepath.Join(dirpath, viewsDirname, field)
+	wanted := deriveViewLinks(dirpath, viewDirpath, deviantFetch, field, hardlink)
+
+	report := ViewReport{}
+	var dirpaths []string
+	if exists, _ := ctx.Fsys().DirExists(viewDirpath); exists {
+		err := ctx.Fsys().Walk(viewDirpath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				dirpaths = append(dirpaths, path)
+				return nil
+			}
+			if target, ok := wanted[path]; ok && isLinked(path, target, hardlink, ctx) {
+				delete(wanted, path)
+				report.Kept++
+				return nil
+			}
+			if _, ok := wanted[path]; !ok {
+				report.Removed++
+			}
+			return ctx.Fsys().Remove(path)
+		})
+		if err != nil {
+			shared.Logger.Error("Failed to update view.", "dirpath", viewDirpath, "error", err)
+			return ViewReport{}, err
+		}
+	}
+
+	linkFileps := make([]string, 0, len(wanted))
+	for each := range wanted {
+		linkFileps = append(linkFileps, each)
+	}
+	sort.Strings(linkFileps)
+	for _, each := range linkFileps {
+		if err := ctx.Fsys().MkdirAll(filepath.Dir(each), 0700); err != nil {
+			shared.Logger.Error("Failed to create path.", "filepath", each, "error", err)
+			return ViewReport{}, err
+		}
+		var err error
+		if hardlink {
+			err = os.Link(wanted[each], each)
+		} else {
+			err = symlink(wanted[each], each, ctx)
+		}
+		if err != nil {
+			shared.Logger.Error("Failed to link file.", "filepath", each, "error", err)
+			return ViewReport{}, err
+		}
+		report.Created++
+	}
+
+	// Deepest first so that directories emptied by their children are removed too.
+	for i := len(dirpaths) - 1; i > 0; i-- {
+		if infos, err := ctx.Fsys().ReadDir(dirpaths[i]); err == nil && len(infos) == 0 {
+			_ = ctx.Fsys().Remove(dirpaths[i])
+		}
+	}
+	shared.Logger.Info(
+		"View built.",
+		"field", field,
+		"created", report.Created,
+		"kept", report.Kept,
+		"removed", report.Removed)
+	return report, nil
+}
+
+// Derive the links of the view in viewDirpath. Return the absolute filepath of each link mapped
+// to the absolute filepath of the file it links to.
+func deriveViewLinks(
+	dirpath, viewDirpath string,
+	deviantFetch djson.DeviantFetch,
+	field string,
+	hardlink bool,
+) map[string]string {
+	deviations := slices.Clone(deviantFetch.SavedDeviations)
+	// Sorted so that the names of colliding links don't change between builds.
+	sort.SliceStable(deviations, func(i, j int) bool {
+		return deviations[i].Filename < deviations[j].Filename
+	})
+	wanted := map[string]string{}
+	for _, each := range deviations {
+		if each.Filename == "" {
+			continue
+		}
+		target := filepath.Join(dirpath, each.Filename)
+		// A hard link to a symbolic link would break when the view is moved.
+		if hardlink && each.Blob != "" {
+			target = filepath.Join(dirpath, each.Blob)
+		}
+		name := filepath.Base(each.Filename)
+		for _, value := range deriveViewValues(each, field) {
+			linkFilep := filepath.Join(viewDirpath, value, name)
+			if existing, ok := wanted[linkFilep]; ok && existing != target {
+				// Files in different deviations' directories can have the same name. The name of
+				// the deviation's directory, a UUID, tells them apart.
+				ext := filepath.Ext(name)
+				uuid := filepath.Base(filepath.Dir(each.Filename))
+				linkFilep = filepath.Join(
+					viewDirpath,
+					value,
+					strings.TrimSuffix(name, ext)+"-"+uuid+ext)
+			}
+			wanted[linkFilep] = target
+		}
+	}
+	return wanted
+}
+
+// Derive the sub directories of deviation in a view by field. Each is a filepath relative to the
+// view's directory.
+func deriveViewValues(deviation djson.SavedDeviation, field string) []string {
+	item := deviation.RssItem
+	var values []string
+	switch field {
+	case "author":
+		values = []string{item.Author}
+	case "year":
+		if parsed, ok := parsePublicationDate(item.PublicationDate); ok {
+			values = []string{strconv.Itoa(parsed.Year())}
+		}
+	case "category":
+		var segments []string
+		for _, each := range strings.Split(item.Category, "/") {
+			if strings.TrimSpace(each) != "" {
+				segments = append(segments, sanitizeFilename(each))
+			}
+		}
+		if len(segments) > 0 {
+			return []string{filepath.Join(segments...)}
+		}
+	case "medium":
+		values = []string{item.Medium}
+	case "license":
+		values = []string{item.License.Name}
+	case "rating":
+		values = []string{item.Rating}
+	case "collection":
+		for _, each := range deviation.Origins {
+			if each.CollectionName != "" && !slices.Contains(values, each.CollectionName) {
+				values = append(values, each.CollectionName)
+			}
+		}
+	case "favoritedby":
+		values = deviation.FavoritedBy
+	default:
+		values = resolveViewFieldPath(deviation, field)
+	}
+	var sanitized []string
+	for _, each := range values {
+		if strings.TrimSpace(each) != "" {
+			sanitized = append(sanitized, sanitizeFilename(each))
+		}
+	}
+	if len(sanitized) == 0 {
+		return []string{unknownViewValue}
+	}
+	return sanitized
+}
+
+// Tell whether path, e.g. "Origins.Kind", is the path of a field in the manifest's deviations
+// whose values can be grouped by.
+func isViewFieldPath(path string) bool {
+	_, ok := splitViewFieldPath(path)
+	return ok
+}
+
+// Split path into field names in SavedDeviation. Paths that don't lead to a value, e.g. to a whole
+// struct, aren't ok. A path that isn't found in SavedDeviation is looked up in RssItem.
+func splitViewFieldPath(path string) ([]string, bool) {
+	names := strings.Split(path, ".")
+	deviationType := reflect.TypeOf(djson.SavedDeviation{})
+	if isValueType(deviationType, names) {
+		return names, true
+	}
+	names = append([]string{"RssItem"}, names...)
+	return names, isValueType(deviationType, names)
+}
+
+// Tell whether names lead from fieldType to a value that can be grouped by.
+func isValueType(fieldType reflect.Type, names []string) bool {
+	for fieldType.Kind() == reflect.Pointer || fieldType.Kind() == reflect.Slice {
+		fieldType = fieldType.Elem()
+	}
+	if len(names) == 0 {
+		switch fieldType.Kind() {
+		case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+			return true
+		}
+		return fieldType == reflect.TypeOf(time.Time{})
+	}
+	if fieldType.Kind() != reflect.Struct || fieldType == reflect.TypeOf(time.Time{}) {
+		return false
+	}
+	field, found := fieldType.FieldByNameFunc(func(name string) bool {
+		return strings.EqualFold(name, names[0])
+	})
+	return found && isValueType(field.Type, names[1:])
+}
+
+// Resolve the values of the field in path in deviation. Lists give a value for each element.
+func resolveViewFieldPath(deviation djson.SavedDeviation, path string) []string {
+	names, ok := splitViewFieldPath(path)
+	if !ok {
+		return nil
+	}
+	return resolveValues(reflect.ValueOf(deviation), names)
+}
+
+func resolveValues(value reflect.Value, names []string) []string {
+	switch value.Kind() {
+	case reflect.Pointer:
+		if value.IsNil() {
+			return nil
+		}
+		return resolveValues(value.Elem(), names)
+	case reflect.Slice:
+		var values []string
+		for i := 0; i < value.Len(); i++ {
+			for _, each := range resolveValues(value.Index(i), names) {
+				if !slices.Contains(values, each) {
+					values = append(values, each)
+				}
+			}
+		}
+		return values
+	}
+	if len(names) == 0 {
+		if timestamp, ok := value.Interface().(time.Time); ok {
+			if timestamp.IsZero() {
+				return nil
+			}
+			return []string{timestamp.Format("2006-01-02")}
+		}
+		return []string{fmt.Sprint(value.Interface())}
+	}
+	field := value.FieldByNameFunc(func(name string) bool {
+		return strings.EqualFold(name, names[0])
+	})
+	return resolveValues(field, names[1:])
+}
+
+// Tell whether linkFilep is a link to targetFilep.
+func isLinked(linkFilep, targetFilep string, hardlink bool, ctx Context) bool {
+	if hardlink {
+		linkInfo, err := os.Lstat(linkFilep)
+		if err != nil {
+			return false
+		}
+		targetInfo, err := os.Stat(targetFilep)
+		return err == nil && os.SameFile(linkInfo, targetInfo)
+	}
+	reader, ok := ctx.Fsys().Fs.(afero.LinkReader)
+	if !ok {
+		return false
+	}
+	target, err := reader.ReadlinkIfPossible(linkFilep)
+	if err != nil {
+		return false
+	}
+	expected, err := filepath.Rel(filepath.Dir(linkFilep), targetFilep)
+	return err == nil && target == expected
+}
+
+// Create linkFilep as a relative symbolic link to targetFilep.
+func symlink(targetFilep, linkFilep string, ctx Context) error {
+	linker, ok := ctx.Fsys().Fs.(afero.Linker)
+	if !ok {
+		return errors.New("symbolic links aren't supported by the file system")
+	}
+	target, err := filepath.Rel(filepath.Dir(linkFilep), targetFilep)
+	if err != nil {
+		return err
+	}
+	return linker.SymlinkIfPossible(target, linkFilep)
+}
@@ -0,0 +1,234 @@
+package dafavorites
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	djson "github.com/denarced/dafavorites/lib/dafavorites/json"
+	"github.com/denarced/dafavorites/shared/shared"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create an archive with a file for each of deviations in a temporary directory.
+func createViewArchive(
+	t *testing.T,
+	deviations ...djson.SavedDeviation,
+) (string, djson.DeviantFetch, *TestContext) {
+	dirp := t.TempDir()
+	fsys := &afero.Afero{Fs: afero.NewOsFs()}
+	for i, each := range deviations {
+		filep := filepath.Join(dirp, each.Filename)
+		require.Nil(t, fsys.MkdirAll(filepath.Dir(filep), 0700))
+		require.Nil(t, fsys.WriteFile(filep, []byte(each.Filename), 0600))
+		deviations[i].Size = int64(len(each.Filename))
+		deviations[i].SHA256 = sha256Hex(each.Filename)
+	}
+	deviantFetch := djson.DeviantFetch{SavedDeviations: deviations}
+	return dirp, deviantFetch, &TestContext{fsys: fsys}
+}
+
+func createViewDeviation(filename, author, date string) djson.SavedDeviation {
+	return djson.SavedDeviation{
+		RssItem:  djson.RssItem{Author: author, PublicationDate: date},
+		Filename: filename,
+	}
+}
+
+func TestBuildView(t *testing.T) {
+	shared.InitTestLogging(t)
+	anna := createViewDeviation(
+		filepath.Join("a", "anna.jpg"),
+		"WojtekFus",
+		"Mon, 15 Apr 2024 08:29:36 PDT")
+	kat := createViewDeviation(
+		filepath.Join("b", "kat.jpg"),
+		"WojtekFus",
+		"Sun, 14 Apr 2019 10:00:00 UTC")
+	otherKat := createViewDeviation(filepath.Join("c", "kat.jpg"), "WojtekFus", "")
+	dirp, deviantFetch, ctx := createViewArchive(t, anna, kat, otherKat)
+	req := require.New(t)
+	readView := func(field string) map[string]string {
+		links := map[string]string{}
+		viewDirp := filepath.Join(dirp, viewsDirname, field)
+		err := filepath.Walk(viewDirp, func(path string, info os.FileInfo, err error) error {
+			req.Nil(err)
+			if info.IsDir() {
+				return nil
+			}
+			req.NotZero(info.Mode()&os.ModeSymlink, "Should be a link: %s.", path)
+			content, err := os.ReadFile(path)
+			req.Nil(err)
+			relative, err := filepath.Rel(viewDirp, path)
+			req.Nil(err)
+			links[relative] = string(content)
+			return nil
+		})
+		req.Nil(err)
+		return links
+	}
+
+	// EXERCISE
+	report, err := BuildView(dirp, deviantFetch, "author", false, ctx)
+
+	// VERIFY
+	req.Nil(err)
+	req.Equal(ViewReport{Created: 3}, report)
+	req.Equal(
+		map[string]string{
+			filepath.Join("WojtekFus", "anna.jpg"):  anna.Filename,
+			filepath.Join("WojtekFus", "kat.jpg"):   kat.Filename,
+			filepath.Join("WojtekFus", "kat-c.jpg"): otherKat.Filename,
+		},
+		readView("author"))
+
+	// EXERCISE
+	report, err = BuildView(dirp, deviantFetch, "year", false, ctx)
+
+	// VERIFY
+	req.Nil(err)
+	req.Equal(ViewReport{Created: 3}, report)
+	req.Equal(
+		map[string]string{
+			filepath.Join("2024", "anna.jpg"):          anna.Filename,
+			filepath.Join("2019", "kat.jpg"):           kat.Filename,
+			filepath.Join(unknownViewValue, "kat.jpg"): otherKat.Filename,
+		},
+		readView("year"))
+
+	// EXERCISE
+	deviantFetch.SavedDeviations = deviantFetch.SavedDeviations[:2]
+	deviantFetch.SavedDeviations[1].RssItem.Author = "Painter"
+	report, err = BuildView(dirp, deviantFetch, "author", false, ctx)
+
+	// VERIFY
+	req.Nil(err)
+	req.Equal(ViewReport{Created: 1, Kept: 1, Removed: 2}, report)
+	req.Equal(
+		map[string]string{
+			filepath.Join("WojtekFus", "anna.jpg"): anna.Filename,
+			filepath.Join("Painter", "kat.jpg"):    kat.Filename,
+		},
+		readView("author"))
+
+	verifyReport, err := Verify(dirp, deviantFetch, nil, ctx)
+	req.Nil(err)
+	req.Equal([]string{otherKat.Filename}, verifyReport.Extra, "Views shouldn't be extra.")
+}
+
+func TestBuildViewWithHardLinks(t *testing.T) {
+	shared.InitTestLogging(t)
+	anna := createViewDeviation(filepath.Join("a", "anna.jpg"), "WojtekFus", "")
+	anna.RssItem.Category = "digitalart/paintings"
+	dirp, deviantFetch, ctx := createViewArchive(t, anna)
+
+	// EXERCISE
+	report, err := BuildView(dirp, deviantFetch, "category", true, ctx)
+
+	// VERIFY
+	req := require.New(t)
+	req.Nil(err)
+	req.Equal(ViewReport{Created: 1}, report)
+	linkInfo, err := os.Lstat(
+		filepath.Join(dirp, viewsDirname, "category", "digitalart", "paintings", "anna.jpg"))
+	req.Nil(err)
+	targetInfo, err := os.Stat(filepath.Join(dirp, anna.Filename))
+	req.Nil(err)
+	req.True(os.SameFile(linkInfo, targetInfo))
+
+	// EXERCISE
+	report, err = BuildView(dirp, deviantFetch, "category", true, ctx)
+
+	// VERIFY
+	req.Nil(err)
+	req.Equal(ViewReport{Kept: 1}, report)
+}
+
+func TestDeriveViewValues(t *testing.T) {
+	run := func(name, field string, deviation djson.SavedDeviation, expected ...string) {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, expected, deriveViewValues(deviation, field))
+		})
+	}
+
+	run("empty author", "author", djson.SavedDeviation{}, unknownViewValue)
+	run(
+		"sanitized author",
+		"author",
+		djson.SavedDeviation{RssItem: djson.RssItem{Author: "../a/b"}},
+		"_a_b")
+	run(
+		"collections",
+		"collection",
+		djson.SavedDeviation{Origins: []djson.Origin{
+			{Kind: SourceFavorites},
+			{Kind: SourceFavorites, CollectionName: "Sci-Fi"},
+			{Kind: SourceFavorites, CollectionName: "Space"},
+		}},
+		"Sci-Fi",
+		"Space")
+	run(
+		"favorited by",
+		"favoritedby",
+		djson.SavedDeviation{FavoritedBy: []string{"david", "maria"}},
+		"david",
+		"maria")
+	run(
+		"license",
+		"license",
+		djson.SavedDeviation{RssItem: djson.RssItem{License: djson.License{Name: "CC-BY-4.0"}}},
+		"CC-BY-4.0")
+	run(
+		"title without RssItem",
+		"title",
+		djson.SavedDeviation{RssItem: djson.RssItem{Title: "Kat"}},
+		"Kat")
+	run(
+		"origin kinds",
+		"Origins.Kind",
+		djson.SavedDeviation{Origins: []djson.Origin{
+			{Kind: SourceFavorites, Username: "david"},
+			{Kind: SourceFavorites, Username: "maria"},
+			{Kind: SourceGallery},
+		}},
+		SourceFavorites,
+		SourceGallery)
+	run(
+		"width",
+		"rssitem.dimensions.width",
+		djson.SavedDeviation{RssItem: djson.RssItem{Dimensions: djson.Dimensions{Width: 730}}},
+		"730")
+}
+
+func TestResolveValuesOfTimes(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	times := struct {
+		At      time.Time
+		Pointer *time.Time
+		Missing *time.Time
+	}{At: at, Pointer: &at}
+
+	// EXERCISE & VERIFY
+	ass := assert.New(t)
+	ass.Equal([]string{"2024-05-01"}, resolveValues(reflect.ValueOf(times), []string{"at"}))
+	ass.Equal([]string{"2024-05-01"}, resolveValues(reflect.ValueOf(times), []string{"pointer"}))
+	ass.Empty(resolveValues(reflect.ValueOf(times), []string{"missing"}))
+}
+
+func TestBuildViewUnknownField(t *testing.T) {
+	shared.InitTestLogging(t)
+	ctx := &TestContext{fsys: &afero.Afero{Fs: afero.NewMemMapFs()}}
+
+	// A whole struct isn't a value to group by.
+	for _, each := range []string{"colour", "RssItem.License", "Origins.Colour"} {
+		// EXERCISE
+		_, err := BuildView("/root", djson.DeviantFetch{}, each, false, ctx)
+
+		// VERIFY
+		require.NotNil(t, err, each)
+	}
+}
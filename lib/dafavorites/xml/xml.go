@@ -9,6 +9,17 @@ package xml
 
 import "encoding/xml"
 
+const (
+	// MediaNamespace is the namespace of Media RSS elements, e.g. <media:content>.
+	MediaNamespace = "http://search.yahoo.com/mrss/"
+	// AtomNamespace is the namespace of Atom elements, e.g. <atom:link>.
+	AtomNamespace = "http://www.w3.org/2005/Atom"
+	// CreativeCommonsNamespace is the namespace of <creativeCommons:license>.
+	CreativeCommonsNamespace = "http://backend.userland.com/creativeCommonsRssModule"
+	// DublinCoreNamespace is the namespace of Dublin Core elements, e.g. <dc:creator>.
+	DublinCoreNamespace = "http://purl.org/dc/elements/1.1/"
+)
+
 // RssElement is the root element of Deviant Art's RSS xml
 type RssElement struct {
 	XMLName xml.Name `xml:"rss"`
@@ -20,12 +31,59 @@ type RssElement struct {
 // ChannelElement is the single channel element in Deviant Art RSS xml
 // that's located inside the root rss element.
 type ChannelElement struct {
-	// The link elements. In this bunch we're mostly interested in the "next"
-	// links.
-	Links []LinkElement `xml:"link"`
+	// The plain <link> element, i.e. the URL of the website.
+	Link string
+	// The <atom:link> elements. In this bunch we're mostly interested in the
+	// "next" links.
+	Links []LinkElement
 	// The actual item elements, each of which contains a single favorite
 	// deviation.
-	RssItems []RssItemElement `xml:"item"`
+	RssItems []RssItemElement
+}
+
+// UnmarshalXML decodes the channel by both namespace and name of each element
+// so that <link> and <atom:link> aren't conflated.
+func (v *ChannelElement) UnmarshalXML(decoder *xml.Decoder, _ xml.StartElement) error {
+	return decodeChildren(decoder, func(element xml.StartElement) error {
+		switch element.Name {
+		case xml.Name{Local: "link"}:
+			return decoder.DecodeElement(&v.Link, &element)
+		case xml.Name{Space: AtomNamespace, Local: "link"}:
+			link := LinkElement{}
+			if err := decoder.DecodeElement(&link, &element); err != nil {
+				return err
+			}
+			v.Links = append(v.Links, link)
+			return nil
+		case xml.Name{Local: "item"}:
+			item := RssItemElement{}
+			if err := decoder.DecodeElement(&item, &element); err != nil {
+				return err
+			}
+			v.RssItems = append(v.RssItems, item)
+			return nil
+		}
+		return decoder.Skip()
+	})
+}
+
+// Decode each child element of the current element with decodeChild. Each
+// call must consume the whole child element, e.g. with Decoder.Skip.
+func decodeChildren(decoder *xml.Decoder, decodeChild func(xml.StartElement) error) error {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch element := token.(type) {
+		case xml.EndElement:
+			return nil
+		case xml.StartElement:
+			if err := decodeChild(element); err != nil {
+				return err
+			}
+		}
+	}
 }
 
 // LinkElement is a URL to another Deviant Art RSS xml
@@ -34,6 +92,8 @@ type LinkElement struct {
 	// and then the URL in "next" contains the next RSS xml that contains more.
 	Rel  string `xml:"rel,attr"`
 	Href string `xml:"href,attr"`
+	// MIME type, e.g. "image/jpeg" for Atom enclosures.
+	Type string `xml:"type,attr"`
 }
 
 // RssItemElement is a single <item> in deviant art RSS xml.
@@ -58,15 +118,154 @@ type LinkElement struct {
 //		   <description>Image done for the workshop in Taipei that&#039;s going to happen next week:&amp;nbsp;&lt;a class=&quot;external&quot; href=&quot;http://www.deviantart.com/users/outgoing?http://www.likmeetup.com/&quot;&gt;www.likmeetup.com/&lt;/a&gt;&lt;br /&gt;&lt;br /&gt;Struggled with it a lot myself, but I&#039;m letting it go, haha &lt;img src=&quot;http://e.deviantart.net/emoticons/s/smile.gif&quot; width=&quot;15&quot; height=&quot;15&quot; alt=&quot;:)&quot; data-embed-type=&quot;emoticon&quot; data-embed-id=&quot;391&quot; title=&quot;:) (Smile)&quot;/&gt; Hope you like it! Love you guys!&lt;br /&gt;&lt;div&gt;&lt;img src=&quot;http://t15.deviantart.net/ZS17sMYJv1Whk_q1lyP4DrvdH30=/300x200/filters:fixed_height(100,100):origin()/pre03/bbec/th/pre/f/2015/347/b/f/model_no__th_x11_38_by_wojtekfus-d9k1rbm.jpg&quot; alt=&quot;thumbnail&quot; /&gt;&lt;/div&gt;</description>
 //	   </item>
 type RssItemElement struct {
-	Title           string              `xml:"title"`
-	Link            string              `xml:"link"`
-	GUID            string              `xml:"guid"`
-	PublicationDate string              `xml:"pubDate"`
-	URL             string              `xml:"url"`
-	Width           int                 `xml:"width"`
-	Height          int                 `xml:"height"`
-	Credits         []ItemCreditElement `xml:"credit"`
-	Content         ItemContentElement  `xml:"content"`
+	Title           string
+	Link            string
+	GUID            string
+	PublicationDate string
+	// <media:title>
+	MediaTitle string
+	// <media:rating>
+	Rating string
+	// <media:category>
+	Category ItemCategoryElement
+	// <media:credit>
+	Credits []ItemCreditElement
+	// <media:content> elements directly in the item.
+	Contents []ItemContentElement
+	// <media:group> elements, each with alternative <media:content> elements.
+	Groups []ItemGroupElement
+	// <media:copyright>
+	Copyright ItemCopyrightElement
+	// <media:description>, HTML.
+	MediaDescription string
+	// Plain RSS <description>, HTML.
+	Description string
+	// <media:text>, e.g. literature's text.
+	Text string
+	// <creativeCommons:license>
+	License string
+	// Plain RSS <author>, usually an email address.
+	Author string
+	// <dc:creator>
+	Creator string
+	// Plain RSS <enclosure> elements.
+	Enclosures []ItemEnclosureElement
+}
+
+// UnmarshalXML decodes the item by both namespace and name of each element so
+// that e.g. <title> and <media:title> aren't conflated.
+func (v *RssItemElement) UnmarshalXML(decoder *xml.Decoder, _ xml.StartElement) error {
+	return decodeChildren(decoder, func(element xml.StartElement) error {
+		var target interface{}
+		switch element.Name {
+		case xml.Name{Local: "title"}:
+			target = &v.Title
+		case xml.Name{Local: "link"}:
+			target = &v.Link
+		case xml.Name{Local: "guid"}:
+			target = &v.GUID
+		case xml.Name{Local: "pubDate"}:
+			target = &v.PublicationDate
+		case xml.Name{Space: MediaNamespace, Local: "title"}:
+			target = &v.MediaTitle
+		case xml.Name{Space: MediaNamespace, Local: "rating"}:
+			target = &v.Rating
+		case xml.Name{Space: MediaNamespace, Local: "category"}:
+			target = &v.Category
+		case xml.Name{Space: MediaNamespace, Local: "credit"}:
+			v.Credits = append(v.Credits, ItemCreditElement{})
+			target = &v.Credits[len(v.Credits)-1]
+		case xml.Name{Space: MediaNamespace, Local: "content"}:
+			v.Contents = append(v.Contents, ItemContentElement{})
+			target = &v.Contents[len(v.Contents)-1]
+		case xml.Name{Space: MediaNamespace, Local: "group"}:
+			v.Groups = append(v.Groups, ItemGroupElement{})
+			target = &v.Groups[len(v.Groups)-1]
+		case xml.Name{Space: MediaNamespace, Local: "copyright"}:
+			target = &v.Copyright
+		case xml.Name{Space: MediaNamespace, Local: "description"}:
+			target = &v.MediaDescription
+		case xml.Name{Local: "description"}:
+			target = &v.Description
+		case xml.Name{Space: MediaNamespace, Local: "text"}:
+			target = &v.Text
+		case xml.Name{Space: CreativeCommonsNamespace, Local: "license"}:
+			target = &v.License
+		case xml.Name{Local: "author"}:
+			target = &v.Author
+		case xml.Name{Space: DublinCoreNamespace, Local: "creator"}:
+			target = &v.Creator
+		case xml.Name{Local: "enclosure"}:
+			v.Enclosures = append(v.Enclosures, ItemEnclosureElement{})
+			target = &v.Enclosures[len(v.Enclosures)-1]
+		default:
+			return decoder.Skip()
+		}
+		return decoder.DecodeElement(target, &element)
+	})
+}
+
+// ItemEnclosureElement is a plain RSS enclosure, i.e. an attached file.
+// Example:
+//
+//	<enclosure url="https://example.com/image.jpg" length="12345" type="image/jpeg"/>
+type ItemEnclosureElement struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// AtomFeedElement is the root element of an Atom feed.
+type AtomFeedElement struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	// The feed's links, e.g. rel="next" for the next page as in RFC 5005.
+	Links   []LinkElement      `xml:"http://www.w3.org/2005/Atom link"`
+	Entries []AtomEntryElement `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+// AtomEntryElement is a single <entry> in an Atom feed.
+// Example:
+//
+//	<entry>
+//	    <id>tag:example.com,2024:1</id>
+//	    <title>Kat</title>
+//	    <published>2024-04-15T08:29:36-07:00</published>
+//	    <author><name>FriesellFly</name></author>
+//	    <link rel="alternate" href="https://example.com/kat"/>
+//	    <link rel="enclosure" type="image/jpeg" href="https://example.com/kat.jpg"/>
+//	</entry>
+type AtomEntryElement struct {
+	ID        string              `xml:"http://www.w3.org/2005/Atom id"`
+	Title     string              `xml:"http://www.w3.org/2005/Atom title"`
+	Published string              `xml:"http://www.w3.org/2005/Atom published"`
+	Updated   string              `xml:"http://www.w3.org/2005/Atom updated"`
+	Authors   []AtomPersonElement `xml:"http://www.w3.org/2005/Atom author"`
+	Links     []LinkElement       `xml:"http://www.w3.org/2005/Atom link"`
+	// HTML or plain text, depending on attribute type.
+	Summary string `xml:"http://www.w3.org/2005/Atom summary"`
+	// Media RSS elements are used in Atom feeds as well.
+	Contents []ItemContentElement `xml:"http://search.yahoo.com/mrss/ content"`
+	Groups   []ItemGroupElement   `xml:"http://search.yahoo.com/mrss/ group"`
+	Credits  []ItemCreditElement  `xml:"http://search.yahoo.com/mrss/ credit"`
+}
+
+// AtomPersonElement is e.g. the author of an Atom entry.
+type AtomPersonElement struct {
+	Name string `xml:"http://www.w3.org/2005/Atom name"`
+}
+
+// ItemGroupElement is a <media:group> that contains alternative versions of
+// the same media.
+type ItemGroupElement struct {
+	Contents []ItemContentElement `xml:"http://search.yahoo.com/mrss/ content"`
+}
+
+// ItemCategoryElement is the category of a deviation in Deviant Art RSS xml.
+// Example:
+//
+//	<media:category label="Sci-Fi">digitalart/paintings/scifi</media:category>
+type ItemCategoryElement struct {
+	Label string `xml:"label,attr"`
+	Value string `xml:",chardata"`
 }
 
 // ItemContentElement in deviant art RSS xml.
@@ -81,6 +280,20 @@ type ItemContentElement struct {
 	URL    string `xml:"url,attr"`
 	Width  int    `xml:"width,attr"`
 	Height int    `xml:"height,attr"`
+	// E.g. "image" or "video".
+	Medium string `xml:"medium,attr"`
+	// MIME type, e.g. "image/jpeg".
+	Type string `xml:"type,attr"`
+	// "true" for the default version in a <media:group>.
+	IsDefault string `xml:"isDefault,attr"`
+}
+
+// ItemCopyrightElement is the copyright notice of a deviation, e.g.
+// <media:copyright url="http://wojtekfus.deviantart.com">Copyright 2015 WojtekFus</media:copyright>.
+type ItemCopyrightElement struct {
+	// The author's profile.
+	URL   string `xml:"url,attr"`
+	Value string `xml:",chardata"`
 }
 
 // ItemCreditElement is a credit element in Deviant Art RSS xml.